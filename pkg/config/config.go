@@ -1,6 +1,10 @@
 package config
 
-import "github.com/urfave/cli/v2"
+import (
+	"time"
+
+	"github.com/urfave/cli/v2"
+)
 
 var (
 	// Github - github configuration
@@ -14,14 +18,32 @@ var (
 		Organizations     cli.StringSlice
 		APIURL            string
 		CacheSizeBytes    int64
+		RequestTimeout    time.Duration
+		MaxRetries        int
 	}
 	Metrics struct {
 		FetchWorkflowRunUsage bool
+		FetchWorkflowJobs     bool
+		FetchWorkflowJobSteps bool
+		FetchArtifacts        bool
+		FetchActionsCache     bool
+		FetchWorkflowFiles    bool
+		WorkflowRunsWindow    time.Duration
+
+		WorkflowRunDurationBuckets string
+		ExportRunDurationGauge     bool
+		DefaultBranches            cli.StringSlice
+	}
+	Webhook struct {
+		Secret            string
+		ReconcileInterval time.Duration
 	}
 	Port           int
 	Debug          bool
 	EnterpriseName string
 	WorkflowFields string
+	StepFields     string
+	DataDir        string
 )
 
 // InitConfiguration - set configuration from env vars or command parameters
@@ -120,6 +142,76 @@ func InitConfiguration() []cli.Flag {
 			Value:       true,
 			Destination: &Metrics.FetchWorkflowRunUsage,
 		},
+		&cli.BoolFlag{
+			Name:        "fetch_workflow_jobs",
+			EnvVars:     []string{"FETCH_WORKFLOW_JOBS"},
+			Usage:       "When true, will perform an API call per workflow run to fetch the jobs of the run",
+			Value:       false,
+			Destination: &Metrics.FetchWorkflowJobs,
+		},
+		&cli.BoolFlag{
+			Name:        "fetch_workflow_job_steps",
+			EnvVars:     []string{"FETCH_WORKFLOW_JOB_STEPS"},
+			Usage:       "When true, will export the timing and conclusion of every step of the workflow jobs",
+			Value:       false,
+			Destination: &Metrics.FetchWorkflowJobSteps,
+		},
+		&cli.BoolFlag{
+			Name:        "fetch_artifacts",
+			EnvVars:     []string{"FETCH_ARTIFACTS"},
+			Usage:       "When true, will page through the artifacts of every repository to export the artifacts inventory and storage",
+			Value:       false,
+			Destination: &Metrics.FetchArtifacts,
+		},
+		&cli.BoolFlag{
+			Name:        "fetch_actions_cache",
+			EnvVars:     []string{"FETCH_ACTIONS_CACHE"},
+			Usage:       "When true, will fetch the Actions cache usage and list the cache entries of every repository",
+			Value:       false,
+			Destination: &Metrics.FetchActionsCache,
+		},
+		&cli.BoolFlag{
+			Name:        "fetch_workflow_files",
+			EnvVars:     []string{"FETCH_WORKFLOW_FILES"},
+			Usage:       "When true, will fetch and parse the file of every active workflow to check the scheduled runs against their cron expressions and export the actions they use",
+			Value:       false,
+			Destination: &Metrics.FetchWorkflowFiles,
+		},
+		&cli.StringFlag{
+			Name:        "export_step_fields",
+			EnvVars:     []string{"EXPORT_STEP_FIELDS"},
+			Usage:       "A comma separated list of fields for workflow job step metrics that should be exported",
+			Value:       "repo,workflow,job,step",
+			Destination: &StepFields,
+		},
+		&cli.DurationFlag{
+			Name:        "workflow_runs_window",
+			EnvVars:     []string{"WORKFLOW_RUNS_WINDOW"},
+			Usage:       "Lookback window of the workflow runs, only the runs created in this window are exported (like 8h or 90m)",
+			Value:       8 * time.Hour,
+			Destination: &Metrics.WorkflowRunsWindow,
+		},
+		&cli.StringFlag{
+			Name:        "workflow_run_duration_buckets",
+			EnvVars:     []string{"WORKFLOW_RUN_DURATION_BUCKETS"},
+			Usage:       "A comma separated list of the bucket upper bounds (in seconds) of the workflow run duration histogram",
+			Value:       "30,60,120,300,600,900,1200,1800,2700,3600,7200",
+			Destination: &Metrics.WorkflowRunDurationBuckets,
+		},
+		&cli.BoolFlag{
+			Name:        "export_workflow_run_duration_ms",
+			EnvVars:     []string{"EXPORT_WORKFLOW_RUN_DURATION_MS"},
+			Usage:       "When true, will also export the deprecated github_workflow_run_duration_ms gauge, with one series per workflow run",
+			Value:       false,
+			Destination: &Metrics.ExportRunDurationGauge,
+		},
+		&cli.StringSliceFlag{
+			Name:        "default_branches",
+			EnvVars:     []string{"DEFAULT_BRANCHES"},
+			Usage:       "List of the branches classified as default branch in the aggregated workflow metrics. Format <branch>,<branch2>",
+			Value:       cli.NewStringSlice("main", "master"),
+			Destination: &Metrics.DefaultBranches,
+		},
 		&cli.Int64Flag{
 			Name:        "github_cache_size_bytes",
 			EnvVars:     []string{"GITHUB_CACHE_SIZE_BYTES"},
@@ -127,5 +219,38 @@ func InitConfiguration() []cli.Flag {
 			Usage:       "Size of Github HTTP cache in bytes",
 			Destination: &Github.CacheSizeBytes,
 		},
+		&cli.DurationFlag{
+			Name:        "github_request_timeout",
+			EnvVars:     []string{"GITHUB_REQUEST_TIMEOUT"},
+			Value:       30 * time.Second,
+			Usage:       "Timeout of every request to the Github API, including the reading of the response body",
+			Destination: &Github.RequestTimeout,
+		},
+		&cli.IntFlag{
+			Name:        "github_max_retries",
+			EnvVars:     []string{"GITHUB_MAX_RETRIES"},
+			Value:       5,
+			Usage:       "Maximum number of retries of a request to the Github API after an error or a rate limit",
+			Destination: &Github.MaxRetries,
+		},
+		&cli.StringFlag{
+			Name:        "webhook_secret",
+			EnvVars:     []string{"WEBHOOK_SECRET"},
+			Usage:       "Secret of the Github webhook delivering the workflow_run, workflow_job and check_run events to /webhook, the endpoint is disabled without it",
+			Destination: &Webhook.Secret,
+		},
+		&cli.DurationFlag{
+			Name:        "webhook_reconcile_interval",
+			EnvVars:     []string{"WEBHOOK_RECONCILE_INTERVAL"},
+			Value:       15 * time.Minute,
+			Usage:       "When the webhook is enabled, how often the workflow runs and jobs received from it are reconciled with the Github API",
+			Destination: &Webhook.ReconcileInterval,
+		},
+		&cli.StringFlag{
+			Name:        "data_dir",
+			EnvVars:     []string{"DATA_DIR"},
+			Usage:       "Directory where the state of the collectors and the Github HTTP cache are persisted across restarts, nothing is persisted without it",
+			Destination: &DataDir,
+		},
 	}
 }
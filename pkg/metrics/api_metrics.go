@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	apiRequestsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_exporter_api_requests_total",
+			Help: "Number of requests sent to the GitHub API, including the ones served by the HTTP cache",
+		},
+		[]string{"collector", "endpoint", "code"},
+	)
+	apiRequestDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_exporter_api_request_duration_seconds",
+			Help:    "Duration (in seconds) of the requests sent to the GitHub API",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"collector", "endpoint"},
+	)
+	apiRetriesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_exporter_api_retries_total",
+			Help: "Number of requests sent to the GitHub API again after an error or a rate limit",
+		},
+		[]string{"collector", "endpoint"},
+	)
+	apiCacheHitsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_exporter_api_cache_hits_total",
+			Help: "Number of requests to the GitHub API served by the HTTP cache",
+		},
+		[]string{"collector", "endpoint"},
+	)
+)
+
+// apiErrors - number of API calls which failed after their retries, by collector
+var apiErrors = struct {
+	sync.Mutex
+	counts map[string]uint64
+}{counts: make(map[string]uint64)}
+
+func getAPIErrorCount(collector string) uint64 {
+	apiErrors.Lock()
+	defer apiErrors.Unlock()
+	return apiErrors.counts[collector]
+}
+
+// countAPIError - account for the outcome of an API call, missing resources aren't errors
+func countAPIError(ctx context.Context, resp *http.Response, err error) {
+	if err == nil && (resp.StatusCode < http.StatusBadRequest || resp.StatusCode == http.StatusNotFound) {
+		return
+	}
+	collector := "unknown"
+	if call, ok := ctx.Value(apiCallKey{}).(*apiCall); ok {
+		collector = call.collector
+	}
+	apiErrors.Lock()
+	apiErrors.counts[collector]++
+	apiErrors.Unlock()
+}
+
+type apiCallKey struct{}
+
+// apiCall - logical API call, which can span several requests (pages and retries)
+type apiCall struct {
+	collector, endpoint string
+}
+
+// apiContext - return the context of a logical API call, used to label the requests it sends
+func apiContext(collector string, endpoint string) context.Context {
+	return context.WithValue(context.Background(), apiCallKey{}, &apiCall{collector, endpoint})
+}
+
+// instrumentedTransport - export the metrics of the requests sent to the GitHub API
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	collector, endpoint := "unknown", "unknown"
+	if call, ok := req.Context().Value(apiCallKey{}).(*apiCall); ok {
+		collector, endpoint = call.collector, call.endpoint
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	apiRequestDurationHistogram.WithLabelValues(collector, endpoint).Observe(time.Since(start).Seconds())
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+		if resp.Header.Get("X-From-Cache") == "1" {
+			apiCacheHitsCounter.WithLabelValues(collector, endpoint).Inc()
+		}
+	}
+	apiRequestsCounter.WithLabelValues(collector, endpoint, code).Inc()
+	return resp, err
+}
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workflowFlakinessGauge = prometheus.NewDesc(
+		"github_workflow_flakiness_score",
+		"Share of the commits of the lookback window on which a workflow both failed and succeeded",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	workflowFlakyCommitsGauge = prometheus.NewDesc(
+		"github_workflow_flaky_commits",
+		"Number of commits of the lookback window on which a workflow both failed and succeeded",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	workflowJobFlakinessGauge = prometheus.NewDesc(
+		"github_workflow_job_flakiness_score",
+		"Share of the commits of the lookback window on which a job both failed and succeeded",
+		[]string{"repo", "workflow", "job"},
+		nil,
+	)
+	workflowJobFlakyCommitsGauge = prometheus.NewDesc(
+		"github_workflow_job_flaky_commits",
+		"Number of commits of the lookback window on which a job both failed and succeeded",
+		[]string{"repo", "workflow", "job"},
+		nil,
+	)
+)
+
+// flakinessOutcome - conclusion of a run attempt or of a job on a commit
+type flakinessOutcome struct {
+	repo, workflow, job, sha string
+	failed                   bool
+	created                  time.Time
+}
+
+// flakinessTracker - remember the outcomes of the run attempts and jobs of the lookback window, by run key or job id,
+// to find the commits on which the same workflow or job both failed and succeeded
+type flakinessTracker struct {
+	mu       sync.Mutex
+	outcomes map[string]flakinessOutcome
+}
+
+var flakiness = &flakinessTracker{outcomes: make(map[string]flakinessOutcome)}
+
+// record - remember the outcome of a run attempt (with an empty job) or of a job. Only successes and failures count.
+func (t *flakinessTracker) record(id string, repo string, workflow string, job string, sha string, conclusion string, created time.Time) {
+	if conclusion != "success" && !isFailureConclusion(conclusion) {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.outcomes[id] = flakinessOutcome{repo, workflow, job, sha, isFailureConclusion(conclusion), created}
+}
+
+// export - export the flakiness of the workflows, or of the jobs when jobs is true, over the outcomes created after windowStart
+func (t *flakinessTracker) export(series *snapshot, jobs bool, windowStart time.Time) {
+	type nameKey struct {
+		repo, workflow, job string
+	}
+	type commitOutcomes struct {
+		failed, succeeded bool
+	}
+	commits := make(map[nameKey]map[string]*commitOutcomes)
+
+	t.mu.Lock()
+	for id, o := range t.outcomes {
+		if o.created.Before(windowStart) {
+			delete(t.outcomes, id)
+			continue
+		}
+		if (o.job != "") != jobs {
+			continue
+		}
+		key := nameKey{o.repo, o.workflow, o.job}
+		if commits[key] == nil {
+			commits[key] = make(map[string]*commitOutcomes)
+		}
+		c, exists := commits[key][o.sha]
+		if !exists {
+			c = &commitOutcomes{}
+			commits[key][o.sha] = c
+		}
+		if o.failed {
+			c.failed = true
+		} else {
+			c.succeeded = true
+		}
+	}
+	t.mu.Unlock()
+
+	for key, shas := range commits {
+		var flaky float64
+		for _, c := range shas {
+			if c.failed && c.succeeded {
+				flaky++
+			}
+		}
+		if jobs {
+			series.set(workflowJobFlakinessGauge, flaky/float64(len(shas)), key.repo, key.workflow, key.job)
+			series.set(workflowJobFlakyCommitsGauge, flaky, key.repo, key.workflow, key.job)
+		} else {
+			series.set(workflowFlakinessGauge, flaky/float64(len(shas)), key.repo, key.workflow)
+			series.set(workflowFlakyCommitsGauge, flaky, key.repo, key.workflow)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+const (
+	// actionRefsRetention - how long the kind of a git ref of an action is remembered before resolving it again
+	actionRefsRetention = 24 * time.Hour
+)
+
+var (
+	actionUsageGauge = prometheus.NewDesc(
+		"github_workflow_action_usage",
+		"Number of references to an action or reusable workflow in a workflow file",
+		[]string{"repo", "workflow", "action", "ref", "pinned"},
+		nil,
+	)
+)
+
+var actionUsageCollector = newSnapshotCollector(actionUsageGauge)
+
+var commitShaRegexp = regexp.MustCompile("^[0-9a-f]{40}$")
+
+type actionRefKind struct {
+	kind     string
+	resolved time.Time
+}
+
+// actionRefKinds - kind (tag, branch or unknown) of the git refs of the actions, by <owner>/<repo>@<ref>.
+// Only used by the action usage collector goroutine.
+var actionRefKinds = make(map[string]actionRefKind)
+
+func getGitRef(owner string, repo string, ref string) *github.Reference {
+	reference, resp, err := client.Git.GetRef(apiContext("action_usage", "GetRef"), owner, repo, ref)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return nil
+		}
+		log.Printf("GetRef error for repo %s/%s and ref %s: %s", owner, repo, ref, err.Error())
+		return nil
+	}
+	return reference
+}
+
+// getActionRefKind - return whether the ref of an action repository is a tag or a branch, tags first like GitHub does
+func getActionRefKind(owner string, repo string, ref string) string {
+	key := owner + "/" + repo + "@" + ref
+	if cached, exists := actionRefKinds[key]; exists && time.Since(cached.resolved) < actionRefsRetention {
+		return cached.kind
+	}
+
+	kind := "unknown"
+	if getGitRef(owner, repo, "tags/"+ref) != nil {
+		kind = "tag"
+	} else if getGitRef(owner, repo, "heads/"+ref) != nil {
+		kind = "branch"
+	}
+	actionRefKinds[key] = actionRefKind{kind, time.Now()}
+	return kind
+}
+
+// parseActionUsage - split a "uses" reference into the action, its ref and how it is pinned
+// (sha, tag, branch, local, docker or unknown)
+func parseActionUsage(uses string) (action string, ref string, pinned string) {
+	if strings.HasPrefix(uses, "./") {
+		return uses, "", "local"
+	}
+	if strings.HasPrefix(uses, "docker://") {
+		image := strings.TrimPrefix(uses, "docker://")
+		if i := strings.Index(image, "@"); i >= 0 {
+			return image[:i], image[i+1:], "docker"
+		}
+		if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+			return image[:i], image[i+1:], "docker"
+		}
+		return image, "", "docker"
+	}
+
+	i := strings.LastIndex(uses, "@")
+	if i < 0 {
+		return uses, "", "unknown"
+	}
+	action, ref = uses[:i], uses[i+1:]
+	if commitShaRegexp.MatchString(ref) {
+		return action, ref, "sha"
+	}
+	r := strings.Split(action, "/")
+	if len(r) < 2 || strings.Contains(ref, "${{") {
+		return action, ref, "unknown"
+	}
+	return action, ref, getActionRefKind(r[0], r[1], ref)
+}
+
+func getActionUsageFromGithub() {
+	if !config.Metrics.FetchWorkflowFiles {
+		return
+	}
+	type actionUsageKey struct {
+		repo, workflow, action, ref, pinned string
+	}
+
+	source := actionUsageCollector.newSource("action_usage", "workflow_files")
+	for {
+		series := source.newSnapshot()
+		usage := make(map[actionUsageKey]float64)
+		for repo, repoWorkflows := range workflows {
+			series.beginScope(repo)
+			r := strings.Split(repo, "/")
+			for _, w := range repoWorkflows {
+				file := getWorkflowFile(r[0], r[1], w.GetPath())
+				if file == nil {
+					continue
+				}
+				for _, uses := range file.uses {
+					action, ref, pinned := parseActionUsage(uses)
+					usage[actionUsageKey{repo, w.GetName(), action, ref, pinned}]++
+				}
+			}
+		}
+
+		for key, count := range usage {
+			series.beginScope(key.repo)
+			series.set(actionUsageGauge, count, key.repo, key.workflow, key.action, key.ref, key.pinned)
+		}
+		source.publish(series)
+
+		time.Sleep(time.Duration(config.Github.Refresh) * 5 * time.Second)
+	}
+}
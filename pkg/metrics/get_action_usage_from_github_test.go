@@ -0,0 +1,101 @@
+package metrics
+
+import (
+	"net/http"
+	"testing"
+)
+
+// newTestGitRefsClient - point the client at a server only knowing the given git refs, by API path
+func newTestGitRefsClient(t *testing.T, refs ...string) *int {
+	known := make(map[string]bool)
+	for _, ref := range refs {
+		known[ref] = true
+	}
+	requests := 0
+	newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !known[r.URL.Path] {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"ref": "refs/x", "object": {"type": "commit", "sha": "abc"}}`))
+	})
+	t.Cleanup(func() { actionRefKinds = make(map[string]actionRefKind) })
+	return &requests
+}
+
+func TestParseActionUsage(t *testing.T) {
+	sha := "8f4b7f84864484a7bf31766abe9204da3cbe65b3"
+
+	tests := []struct {
+		uses   string
+		action string
+		ref    string
+		pinned string
+	}{
+		// local actions and docker images are never resolved
+		{"./.github/actions/setup", "./.github/actions/setup", "", "local"},
+		{"./", "./", "", "local"},
+		{"docker://alpine:3.19", "alpine", "3.19", "docker"},
+		{"docker://ghcr.io/octo/image:1.0", "ghcr.io/octo/image", "1.0", "docker"},
+		{"docker://localhost:5000/image", "localhost:5000/image", "", "docker"},
+		{"docker://alpine@sha256:abcdef", "alpine", "sha256:abcdef", "docker"},
+		{"docker://alpine", "alpine", "", "docker"},
+		// commit SHAs are recognized without resolving them
+		{"actions/checkout@" + sha, "actions/checkout", sha, "sha"},
+		{"octo/actions/composite/setup@" + sha, "octo/actions/composite/setup", sha, "sha"},
+		// abbreviated SHAs are refs like the others
+		{"actions/checkout@8f4b7f8", "actions/checkout", "8f4b7f8", "unknown"},
+		// tags are resolved before branches, like GitHub does
+		{"actions/checkout@v4", "actions/checkout", "v4", "tag"},
+		{"actions/checkout@main", "actions/checkout", "main", "branch"},
+		{"actions/checkout@release", "actions/checkout", "release", "tag"},
+		{"actions/checkout@missing", "actions/checkout", "missing", "unknown"},
+		// composite actions in a subdirectory and reusable workflows are resolved against their repository
+		{"octo/actions/composite/setup@v1", "octo/actions/composite/setup", "v1", "tag"},
+		{"octo/workflows/.github/workflows/ci.yml@main", "octo/workflows/.github/workflows/ci.yml", "main", "branch"},
+		// references which can't be resolved
+		{"actions/checkout", "actions/checkout", "", "unknown"},
+		{"checkout@v4", "checkout", "v4", "unknown"},
+		{"actions/checkout@${{ inputs.ref }}", "actions/checkout", "${{ inputs.ref }}", "unknown"},
+	}
+
+	newTestGitRefsClient(t,
+		"/repos/actions/checkout/git/ref/tags/v4",
+		"/repos/actions/checkout/git/ref/heads/main",
+		"/repos/actions/checkout/git/ref/tags/release",
+		"/repos/actions/checkout/git/ref/heads/release",
+		"/repos/octo/actions/git/ref/tags/v1",
+		"/repos/octo/workflows/git/ref/heads/main",
+	)
+	for _, tt := range tests {
+		t.Run(tt.uses, func(t *testing.T) {
+			action, ref, pinned := parseActionUsage(tt.uses)
+			if action != tt.action || ref != tt.ref || pinned != tt.pinned {
+				t.Errorf("got %q, %q, %q, want %q, %q, %q", action, ref, pinned, tt.action, tt.ref, tt.pinned)
+			}
+		})
+	}
+}
+
+func TestActionRefKindCache(t *testing.T) {
+	requests := newTestGitRefsClient(t, "/repos/actions/checkout/git/ref/tags/v4")
+
+	for i := 0; i < 3; i++ {
+		if _, _, pinned := parseActionUsage("actions/checkout@v4"); pinned != "tag" {
+			t.Fatalf("got %q, want tag", pinned)
+		}
+	}
+	if *requests != 1 {
+		t.Errorf("got %d requests, the ref should only be resolved once", *requests)
+	}
+
+	// a ref which is neither a tag nor a branch is looked up both ways, once
+	for i := 0; i < 3; i++ {
+		parseActionUsage("actions/checkout@missing")
+	}
+	if *requests != 3 {
+		t.Errorf("got %d requests, want 3", *requests)
+	}
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// actionsCacheLimitBytes - size of the Actions cache of a repository before GitHub starts evicting entries
+	actionsCacheLimitBytes = 10 * 1024 * 1024 * 1024
+)
+
+var (
+	actionsCacheSizeGauge = prometheus.NewDesc(
+		"github_actions_cache_size_bytes",
+		"Total size (in bytes) of the active Actions cache entries of a repository",
+		[]string{"repo"},
+		nil,
+	)
+	actionsCacheEntriesGauge = prometheus.NewDesc(
+		"github_actions_cache_entries",
+		"Number of active Actions cache entries of a repository",
+		[]string{"repo"},
+		nil,
+	)
+	actionsCacheLimitRatioGauge = prometheus.NewDesc(
+		"github_actions_cache_limit_ratio",
+		"Share of the 10 GB Actions cache limit of a repository in use",
+		[]string{"repo"},
+		nil,
+	)
+	actionsCacheOrgSizeGauge = prometheus.NewDesc(
+		"github_actions_cache_organization_size_bytes",
+		"Total size (in bytes) of the active Actions cache entries of all the repositories of an organization",
+		[]string{"organization"},
+		nil,
+	)
+	actionsCacheOrgEntriesGauge = prometheus.NewDesc(
+		"github_actions_cache_organization_entries",
+		"Number of active Actions cache entries of all the repositories of an organization",
+		[]string{"organization"},
+		nil,
+	)
+	actionsCacheKeyPrefixSizeGauge = prometheus.NewDesc(
+		"github_actions_cache_key_prefix_size_bytes",
+		"Total size (in bytes) of the Actions cache entries of a repository per cache key prefix",
+		[]string{"repo", "key_prefix"},
+		nil,
+	)
+	actionsCacheKeyPrefixEntriesGauge = prometheus.NewDesc(
+		"github_actions_cache_key_prefix_entries",
+		"Number of Actions cache entries of a repository per cache key prefix",
+		[]string{"repo", "key_prefix"},
+		nil,
+	)
+	actionsCacheKeyPrefixLastAccessedAgeGauge = prometheus.NewDesc(
+		"github_actions_cache_key_prefix_last_accessed_age_seconds",
+		"Time (in seconds) since the least recently accessed Actions cache entry of a repository per cache key prefix was last accessed",
+		[]string{"repo", "key_prefix"},
+		nil,
+	)
+)
+
+var actionsCacheCollector = newSnapshotCollector(actionsCacheSizeGauge, actionsCacheEntriesGauge, actionsCacheLimitRatioGauge, actionsCacheOrgSizeGauge, actionsCacheOrgEntriesGauge, actionsCacheKeyPrefixSizeGauge, actionsCacheKeyPrefixEntriesGauge, actionsCacheKeyPrefixLastAccessedAgeGauge)
+
+type repoActionsCacheUsage struct {
+	FullName                string `json:"full_name"`
+	ActiveCachesSizeInBytes int64  `json:"active_caches_size_in_bytes"`
+	ActiveCachesCount       int64  `json:"active_caches_count"`
+}
+
+type orgActionsCacheUsage struct {
+	TotalActiveCachesSizeInBytes int64 `json:"total_active_caches_size_in_bytes"`
+	TotalActiveCachesCount       int64 `json:"total_active_caches_count"`
+}
+
+type actionsCache struct {
+	ID             int64             `json:"id"`
+	Ref            string            `json:"ref"`
+	Key            string            `json:"key"`
+	Version        string            `json:"version"`
+	LastAccessedAt *github.Timestamp `json:"last_accessed_at,omitempty"`
+	CreatedAt      *github.Timestamp `json:"created_at,omitempty"`
+	SizeInBytes    int64             `json:"size_in_bytes"`
+}
+
+type actionsCacheList struct {
+	TotalCount    int64           `json:"total_count"`
+	ActionsCaches []*actionsCache `json:"actions_caches"`
+}
+
+// getActionsCacheResource - go-github v45 has no method for the Actions cache endpoints
+func getActionsCacheResource(name string, u string, v interface{}) (*github.Response, bool) {
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		log.Printf("%s error for %s: %s", name, u, err.Error())
+		return nil, false
+	}
+
+	resp, err := client.Do(apiContext("actions_cache", name), req, v)
+	if err != nil {
+		log.Printf("%s error for %s: %s", name, u, err.Error())
+		return resp, false
+	}
+	return resp, true
+}
+
+func getRepoActionsCacheUsage(owner string, repo string) *repoActionsCacheUsage {
+	usage := new(repoActionsCacheUsage)
+	if _, ok := getActionsCacheResource("GetActionsCacheUsage", fmt.Sprintf("repos/%s/%s/actions/cache/usage", owner, repo), usage); !ok {
+		return nil
+	}
+	return usage
+}
+
+func getOrgActionsCacheUsage(orga string) *orgActionsCacheUsage {
+	usage := new(orgActionsCacheUsage)
+	if _, ok := getActionsCacheResource("GetActionsCacheUsageForOrg", fmt.Sprintf("orgs/%s/actions/cache/usage", orga), usage); !ok {
+		return nil
+	}
+	return usage
+}
+
+func getAllActionsCaches(owner string, repo string) []*actionsCache {
+	var caches []*actionsCache
+	page := 0
+
+	for {
+		caches_page := new(actionsCacheList)
+		resp, ok := getActionsCacheResource("ListCaches", fmt.Sprintf("repos/%s/%s/actions/caches?per_page=100&page=%d", owner, repo, page), caches_page)
+		if !ok {
+			return caches
+		}
+
+		caches = append(caches, caches_page.ActionsCaches...)
+		if resp.NextPage == 0 {
+			break
+		}
+		page = resp.NextPage
+	}
+
+	return caches
+}
+
+// getCacheKeyPrefix - strip the last dash separated part of a cache key, which usually is a hash of the cached files
+func getCacheKeyPrefix(key string) string {
+	i := strings.LastIndex(key, "-")
+	if i <= 0 {
+		return key
+	}
+	return key[:i]
+}
+
+// getActionsCacheFromGithub - return the Actions cache usage of every repository and organization
+func getActionsCacheFromGithub() {
+	if !config.Metrics.FetchActionsCache {
+		return
+	}
+	type prefixStats struct {
+		size, entries float64
+		lastAccessed  time.Time
+	}
+
+	source := actionsCacheCollector.newSource("actions_cache")
+	for {
+		series := source.newSnapshot()
+		for _, orga := range config.Github.Organizations.Value() {
+			series.beginScope(orga)
+			if usage := getOrgActionsCacheUsage(orga); usage != nil {
+				series.set(actionsCacheOrgSizeGauge, float64(usage.TotalActiveCachesSizeInBytes), orga)
+				series.set(actionsCacheOrgEntriesGauge, float64(usage.TotalActiveCachesCount), orga)
+			}
+		}
+
+		for _, repo := range repositories {
+			series.beginScope(repo)
+			r := strings.Split(repo, "/")
+			if usage := getRepoActionsCacheUsage(r[0], r[1]); usage != nil {
+				series.set(actionsCacheSizeGauge, float64(usage.ActiveCachesSizeInBytes), repo)
+				series.set(actionsCacheEntriesGauge, float64(usage.ActiveCachesCount), repo)
+				series.set(actionsCacheLimitRatioGauge, float64(usage.ActiveCachesSizeInBytes)/actionsCacheLimitBytes, repo)
+				if usage.ActiveCachesCount == 0 {
+					continue
+				}
+			}
+
+			prefixes := make(map[string]*prefixStats)
+			for _, c := range getAllActionsCaches(r[0], r[1]) {
+				prefix := getCacheKeyPrefix(c.Key)
+				s, exists := prefixes[prefix]
+				if !exists {
+					s = &prefixStats{}
+					prefixes[prefix] = s
+				}
+				s.size += float64(c.SizeInBytes)
+				s.entries++
+				if c.LastAccessedAt != nil && (s.lastAccessed.IsZero() || c.LastAccessedAt.Before(s.lastAccessed)) {
+					s.lastAccessed = c.LastAccessedAt.Time
+				}
+			}
+			for prefix, s := range prefixes {
+				series.set(actionsCacheKeyPrefixSizeGauge, s.size, repo, prefix)
+				series.set(actionsCacheKeyPrefixEntriesGauge, s.entries, repo, prefix)
+				if !s.lastAccessed.IsZero() {
+					series.set(actionsCacheKeyPrefixLastAccessedAgeGauge, time.Since(s.lastAccessed).Seconds(), repo, prefix)
+				}
+			}
+		}
+		source.publish(series)
+
+		time.Sleep(time.Duration(config.Github.Refresh) * 5 * time.Second)
+	}
+}
@@ -0,0 +1,184 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	artifactsCountGauge = prometheus.NewDesc(
+		"github_artifacts",
+		"Number of workflow run artifacts, including the expired ones",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	artifactsSizeGauge = prometheus.NewDesc(
+		"github_artifacts_size_bytes",
+		"Total size (in bytes) of the workflow run artifacts which are not expired",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	artifactsExpiredGauge = prometheus.NewDesc(
+		"github_artifacts_expired",
+		"Number of expired workflow run artifacts",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	artifactsOldestAgeGauge = prometheus.NewDesc(
+		"github_artifacts_oldest_age_seconds",
+		"Age (in seconds) of the oldest workflow run artifact which is not expired",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+
+	// artifactRunWorkflows - workflow id of the runs which uploaded artifacts, by run id
+	artifactRunWorkflows = make(map[int64]int64)
+)
+
+var artifactsCollector = newSnapshotCollector(artifactsCountGauge, artifactsSizeGauge, artifactsExpiredGauge, artifactsOldestAgeGauge)
+
+// artifact - github.Artifact along with the fields go-github v45 doesn't decode
+type artifact struct {
+	github.Artifact
+	WorkflowRun *struct {
+		ID *int64 `json:"id,omitempty"`
+	} `json:"workflow_run,omitempty"`
+}
+
+type artifactList struct {
+	TotalCount *int64      `json:"total_count,omitempty"`
+	Artifacts  []*artifact `json:"artifacts,omitempty"`
+}
+
+// listArtifacts - same as client.Actions.ListArtifacts, but keeps the run which uploaded the artifact
+func listArtifacts(ctx context.Context, owner string, repo string, opt *github.ListOptions) (*artifactList, *github.Response, error) {
+	u := fmt.Sprintf("repos/%s/%s/actions/artifacts?per_page=%d&page=%d", owner, repo, opt.PerPage, opt.Page)
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	artifacts := new(artifactList)
+	resp, err := client.Do(ctx, req, artifacts)
+	if err != nil {
+		return nil, resp, err
+	}
+	return artifacts, resp, nil
+}
+
+func getAllArtifacts(owner string, repo string) []*artifact {
+	var artifacts []*artifact
+	opt := &github.ListOptions{PerPage: 100}
+
+	ctx := apiContext("artifacts", "ListArtifacts")
+	for {
+		artifacts_page, resp, err := listArtifacts(ctx, owner, repo, opt)
+		if err != nil {
+			log.Printf("ListArtifacts error for repo %s/%s: %s", owner, repo, err.Error())
+			return artifacts
+		}
+
+		artifacts = append(artifacts, artifacts_page.Artifacts...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return artifacts
+}
+
+// getArtifactWorkflow - return the name of the workflow whose run uploaded the artifact
+func getArtifactWorkflow(owner string, repo string, a *artifact) string {
+	if a.WorkflowRun == nil || a.WorkflowRun.ID == nil {
+		return "unknown"
+	}
+	runId := *a.WorkflowRun.ID
+
+	workflowId, exists := artifactRunWorkflows[runId]
+	if !exists {
+		// runs which can't be fetched (e.g. deleted) are cached too, with the 0 workflow id
+		workflowId = getWorkflowRun("artifacts", owner, repo, runId).GetWorkflowID()
+		artifactRunWorkflows[runId] = workflowId
+	}
+
+	w, exists := workflows[owner+"/"+repo][workflowId]
+	if !exists {
+		return "unknown"
+	}
+	return w.GetName()
+}
+
+// getArtifactsFromGithub - return the artifacts inventory and storage of every repository
+func getArtifactsFromGithub() {
+	if !config.Metrics.FetchArtifacts {
+		return
+	}
+	type artifactsKey struct {
+		repo, workflow string
+	}
+	type artifactsStats struct {
+		count, size, expired float64
+		oldest               time.Time
+	}
+
+	source := artifactsCollector.newSource("artifacts")
+	for {
+		series := source.newSnapshot()
+		stats := make(map[artifactsKey]*artifactsStats)
+		seenRuns := make(map[int64]bool)
+		for _, repo := range repositories {
+			series.beginScope(repo)
+			r := strings.Split(repo, "/")
+			for _, a := range getAllArtifacts(r[0], r[1]) {
+				if a.WorkflowRun != nil && a.WorkflowRun.ID != nil {
+					seenRuns[*a.WorkflowRun.ID] = true
+				}
+				key := artifactsKey{repo, getArtifactWorkflow(r[0], r[1], a)}
+				s, exists := stats[key]
+				if !exists {
+					s = &artifactsStats{}
+					stats[key] = s
+				}
+
+				s.count++
+				if a.GetExpired() {
+					s.expired++
+					continue
+				}
+				s.size += float64(a.GetSizeInBytes())
+				if created := a.GetCreatedAt().Time; s.oldest.IsZero() || created.Before(s.oldest) {
+					s.oldest = created
+				}
+			}
+		}
+
+		for key, s := range stats {
+			series.beginScope(key.repo)
+			series.set(artifactsCountGauge, s.count, key.repo, key.workflow)
+			series.set(artifactsSizeGauge, s.size, key.repo, key.workflow)
+			series.set(artifactsExpiredGauge, s.expired, key.repo, key.workflow)
+			if !s.oldest.IsZero() {
+				series.set(artifactsOldestAgeGauge, time.Since(s.oldest).Seconds(), key.repo, key.workflow)
+			}
+		}
+		source.publish(series)
+
+		// forget runs whose artifacts were deleted
+		for runId := range artifactRunWorkflows {
+			if !seenRuns[runId] {
+				delete(artifactRunWorkflows, runId)
+			}
+		}
+
+		time.Sleep(time.Duration(config.Github.Refresh) * 5 * time.Second)
+	}
+}
@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	billingTotalMinutesUsedGauge = prometheus.NewDesc(
+		"github_billing_actions_total_minutes_used",
+		"Number of GitHub Actions minutes used during the current billing cycle",
+		[]string{"scope", "name"},
+		nil,
+	)
+	billingIncludedMinutesGauge = prometheus.NewDesc(
+		"github_billing_actions_included_minutes",
+		"Number of GitHub Actions minutes included in the plan",
+		[]string{"scope", "name"},
+		nil,
+	)
+	billingPaidMinutesUsedGauge = prometheus.NewDesc(
+		"github_billing_actions_total_paid_minutes_used",
+		"Number of paid GitHub Actions minutes used during the current billing cycle",
+		[]string{"scope", "name"},
+		nil,
+	)
+	billingMinutesUsedBreakdownGauge = prometheus.NewDesc(
+		"github_billing_actions_minutes_used",
+		"Number of GitHub Actions minutes used during the current billing cycle per runner operating system",
+		[]string{"scope", "name", "os"},
+		nil,
+	)
+)
+
+var billingCollector = newSnapshotCollector(billingTotalMinutesUsedGauge, billingIncludedMinutesGauge, billingPaidMinutesUsedGauge, billingMinutesUsedBreakdownGauge)
+
+func getOrgActionsBilling(orga string) *github.ActionBilling {
+	billing, _, err := client.Billing.GetActionsBillingOrg(apiContext("billing", "GetActionsBillingOrg"), orga)
+	if err != nil {
+		log.Printf("GetActionsBillingOrg error for org %s: %s", orga, err.Error())
+		return nil
+	}
+	return billing
+}
+
+// getEnterpriseActionsBilling - go-github v45 has no method for the enterprise billing endpoint, which returns the same payload as the organization one
+func getEnterpriseActionsBilling(enterprise string) *github.ActionBilling {
+	req, err := client.NewRequest("GET", fmt.Sprintf("enterprises/%s/settings/billing/actions", enterprise), nil)
+	if err != nil {
+		log.Printf("GetActionsBillingEnterprise error for enterprise %s: %s", enterprise, err.Error())
+		return nil
+	}
+
+	billing := new(github.ActionBilling)
+	_, err = client.Do(apiContext("billing", "GetActionsBillingEnterprise"), req, billing)
+	if err != nil {
+		log.Printf("GetActionsBillingEnterprise error for enterprise %s: %s", enterprise, err.Error())
+		return nil
+	}
+	return billing
+}
+
+func exportActionsBilling(series *snapshot, scope string, name string, billing *github.ActionBilling) {
+	series.set(billingTotalMinutesUsedGauge, float64(billing.TotalMinutesUsed), scope, name)
+	series.set(billingIncludedMinutesGauge, float64(billing.IncludedMinutes), scope, name)
+	series.set(billingPaidMinutesUsedGauge, billing.TotalPaidMinutesUsed, scope, name)
+	series.set(billingMinutesUsedBreakdownGauge, float64(billing.MinutesUsedBreakdown.Ubuntu), scope, name, "UBUNTU")
+	series.set(billingMinutesUsedBreakdownGauge, float64(billing.MinutesUsedBreakdown.MacOS), scope, name, "MACOS")
+	series.set(billingMinutesUsedBreakdownGauge, float64(billing.MinutesUsedBreakdown.Windows), scope, name, "WINDOWS")
+}
+
+// getActionsBillingFromGithub - return the Actions minutes usage of the organizations and of the enterprise
+func getActionsBillingFromGithub() {
+	source := billingCollector.newSource("billing")
+	for {
+		series := source.newSnapshot()
+		for _, orga := range config.Github.Organizations.Value() {
+			series.beginScope(orga)
+			if billing := getOrgActionsBilling(orga); billing != nil {
+				exportActionsBilling(series, "organization", orga, billing)
+			}
+		}
+		if config.EnterpriseName != "" {
+			series.beginScope(config.EnterpriseName)
+			if billing := getEnterpriseActionsBilling(config.EnterpriseName); billing != nil {
+				exportActionsBilling(series, "enterprise", config.EnterpriseName, billing)
+			}
+		}
+		source.publish(series)
+
+		time.Sleep(time.Duration(config.Github.Refresh) * 5 * time.Second)
+	}
+}
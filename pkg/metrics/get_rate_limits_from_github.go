@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+const (
+	primaryRateLimit   = "primary"
+	secondaryRateLimit = "secondary"
+)
+
+var (
+	rateLimitRemainingGauge = prometheus.NewDesc(
+		"github_rate_limit_remaining",
+		"Number of requests remaining in the current rate limit window of a GitHub API resource",
+		[]string{"credential", "resource"},
+		nil,
+	)
+	rateLimitLimitGauge = prometheus.NewDesc(
+		"github_rate_limit_limit",
+		"Maximum number of requests per rate limit window of a GitHub API resource",
+		[]string{"credential", "resource"},
+		nil,
+	)
+	rateLimitResetGauge = prometheus.NewDesc(
+		"github_rate_limit_reset_timestamp_seconds",
+		"Time (unix timestamp) the current rate limit window of a GitHub API resource resets",
+		[]string{"credential", "resource"},
+		nil,
+	)
+	rateLimitSleepCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_exporter_rate_limit_sleep_seconds_total",
+			Help: "Time (in seconds) the collectors spent sleeping on the primary rate limit or on a secondary rate limit (Retry-After)",
+		},
+		[]string{"collector", "limit"},
+	)
+)
+
+var rateLimitsCollector = newSnapshotCollector(rateLimitRemainingGauge, rateLimitLimitGauge, rateLimitResetGauge)
+
+// rateLimitSleep - sleep on a rate limit, accounting the time to the collector of the API call
+func rateLimitSleep(ctx context.Context, limit string, d time.Duration) error {
+	collector := "unknown"
+	if call, ok := ctx.Value(apiCallKey{}).(*apiCall); ok {
+		collector = call.collector
+	}
+	if d > 0 {
+		rateLimitSleepCounter.WithLabelValues(collector, limit).Add(d.Seconds())
+	}
+	return sleepContext(ctx, d)
+}
+
+// getCredentialName - name of the credential used by the client, without any secret
+func getCredentialName() string {
+	if len(config.Github.Token) > 0 {
+		return "token"
+	}
+	return fmt.Sprintf("app/%d/installation/%d", config.Github.AppID, config.Github.AppInstallationID)
+}
+
+// getRateLimits - same as client.RateLimits, but without storing the limits in the client: go-github would then fail
+// every request locally until the reset once a budget is exhausted, instead of letting retryTransport wait for the reset
+func getRateLimits() *github.RateLimits {
+	req, err := client.NewRequest("GET", "rate_limit", nil)
+	if err != nil {
+		log.Printf("RateLimits error: %s", err.Error())
+		return nil
+	}
+	response := new(struct {
+		Resources *github.RateLimits `json:"resources"`
+	})
+	if _, err := client.Do(apiContext("rate_limits", "RateLimits"), req, response); err != nil {
+		log.Printf("RateLimits error: %s", err.Error())
+		return nil
+	}
+	return response.Resources
+}
+
+func exportRateLimit(series *snapshot, credential string, resource string, rate *github.Rate) {
+	if rate == nil {
+		return
+	}
+	series.set(rateLimitRemainingGauge, float64(rate.Remaining), credential, resource)
+	series.set(rateLimitLimitGauge, float64(rate.Limit), credential, resource)
+	series.set(rateLimitResetGauge, float64(rate.Reset.Unix()), credential, resource)
+}
+
+// getRateLimitsFromGithub - the rate limit endpoint doesn't count against the rate limit
+func getRateLimitsFromGithub() {
+	source := rateLimitsCollector.newSource("rate_limits")
+	credential := getCredentialName()
+	for {
+		series := source.newSnapshot()
+		// the last snapshot is kept, and gets stale, when the rate limits can't be fetched
+		if limits := getRateLimits(); limits != nil {
+			exportRateLimit(series, credential, "core", limits.Core)
+			exportRateLimit(series, credential, "search", limits.Search)
+			exportRateLimit(series, credential, "graphql", limits.GraphQL)
+			source.publish(series)
+		}
+
+		time.Sleep(time.Duration(config.Github.Refresh) * time.Second)
+	}
+}
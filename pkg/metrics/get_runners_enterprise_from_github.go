@@ -1,10 +1,7 @@
 package metrics
 
 import (
-	"context"
 	"log"
-	"math/rand"
-	"net/http"
 	"strconv"
 	"time"
 
@@ -15,12 +12,11 @@ import (
 )
 
 var (
-	runnersEnterpriseGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "github_runner_enterprise_status",
-			Help: "runner status",
-		},
+	runnersEnterpriseGauge = prometheus.NewDesc(
+		"github_runner_enterprise_status",
+		"runner status",
 		[]string{"os", "name", "id"},
+		nil,
 	)
 )
 
@@ -28,21 +24,10 @@ func getAllEnterpriseRunners() []*github.Runner {
 	var runners []*github.Runner
 	opt := &github.ListOptions{PerPage: 200}
 
+	ctx := apiContext("runners_enterprise", "ListEnterpriseRunners")
 	for {
-		resp, rr, err := client.Enterprise.ListRunners(context.Background(), config.EnterpriseName, nil)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("ListRunners ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			if rr != nil && rr.StatusCode == http.StatusForbidden {
-				if retryAfterSeconds, e := strconv.ParseInt(rr.Header.Get("Retry-After"), 10, 32); e == nil {
-					delaySeconds := retryAfterSeconds + (60 * rand.Int63n(randomDelaySeconds))
-					log.Printf("ListRunners Retry-After %d seconds received, sleeping for %d", retryAfterSeconds, delaySeconds)
-					time.Sleep(time.Duration(delaySeconds) * time.Second)
-					continue
-				}
-			}
+		resp, rr, err := client.Enterprise.ListRunners(ctx, config.EnterpriseName, opt)
+		if err != nil {
 			log.Printf("ListRunners error for enterprise %s: %s", config.EnterpriseName, err.Error())
 			return nil
 		}
@@ -61,7 +46,10 @@ func getRunnersEnterpriseFromGithub() {
 	if config.EnterpriseName == "" {
 		return
 	}
+	source := runnersCollector.newSource("runners_enterprise")
 	for {
+		series := source.newSnapshot()
+		series.beginScope(config.EnterpriseName)
 		runners := getAllEnterpriseRunners()
 
 		for _, runner := range runners {
@@ -69,8 +57,11 @@ func getRunnersEnterpriseFromGithub() {
 			if integerStatus = 0; runner.GetStatus() == "online" {
 				integerStatus = 1
 			}
-			runnersEnterpriseGauge.WithLabelValues(*runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10)).Set(integerStatus)
+			series.set(runnersEnterpriseGauge, integerStatus, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10))
 		}
+		runnerGroups := map[string]map[int64]string{config.EnterpriseName: getRunnerGroupNames(runnerScopeEnterprise, config.EnterpriseName, runners)}
+		exportRunnersInfo(series, runnerScopeEnterprise, map[string][]*github.Runner{config.EnterpriseName: runners}, runnerGroups)
+		source.publish(series)
 
 		time.Sleep(time.Duration(config.Github.Refresh) * time.Second)
 	}
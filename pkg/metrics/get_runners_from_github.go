@@ -1,10 +1,7 @@
 package metrics
 
 import (
-	"context"
 	"log"
-	"math/rand"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -16,12 +13,11 @@ import (
 )
 
 var (
-	runnersGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "github_runner_status",
-			Help: "runner status",
-		},
+	runnersGauge = prometheus.NewDesc(
+		"github_runner_status",
+		"runner status",
 		[]string{"repo", "os", "name", "id", "busy"},
+		nil,
 	)
 )
 
@@ -29,21 +25,10 @@ func getAllRepoRunners(owner string, repo string) []*github.Runner {
 	var runners []*github.Runner
 	opt := &github.ListOptions{PerPage: 200}
 
+	ctx := apiContext("runners", "ListRunners")
 	for {
-		resp, rr, err := client.Actions.ListRunners(context.Background(), owner, repo, opt)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("ListRunners ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			if rr != nil && rr.StatusCode == http.StatusForbidden {
-				if retryAfterSeconds, e := strconv.ParseInt(rr.Header.Get("Retry-After"), 10, 32); e == nil {
-					delaySeconds := retryAfterSeconds + (60 * rand.Int63n(randomDelaySeconds))
-					log.Printf("ListRunners Retry-After %d seconds received, sleeping for %d", retryAfterSeconds, delaySeconds)
-					time.Sleep(time.Duration(delaySeconds) * time.Second)
-					continue
-				}
-			}
+		resp, rr, err := client.Actions.ListRunners(ctx, owner, repo, opt)
+		if err != nil {
 			log.Printf("ListRunners error for repo %s: %s", repo, err.Error())
 			return nil
 		}
@@ -60,19 +45,26 @@ func getAllRepoRunners(owner string, repo string) []*github.Runner {
 
 // getRunnersFromGithub - return information about runners and their status for a specific repo
 func getRunnersFromGithub() {
+	source := runnersCollector.newSource("runners")
 	for {
+		series := source.newSnapshot()
+		runnersPerRepo := make(map[string][]*github.Runner)
 		for _, repo := range repositories {
+			series.beginScope(repo)
 			r := strings.Split(repo, "/")
 
 			runners := getAllRepoRunners(r[0], r[1])
+			runnersPerRepo[repo] = runners
 			for _, runner := range runners {
 				if runner.GetStatus() == "online" {
-					runnersGauge.WithLabelValues(repo, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy())).Set(1)
+					series.set(runnersGauge, 1, repo, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy()))
 				} else {
-					runnersGauge.WithLabelValues(repo, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy())).Set(0)
+					series.set(runnersGauge, 0, repo, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy()))
 				}
 			}
 		}
+		exportRunnersInfo(series, runnerScopeRepo, runnersPerRepo, nil)
+		source.publish(series)
 
 		time.Sleep(time.Duration(config.Github.Refresh) * time.Second)
 	}
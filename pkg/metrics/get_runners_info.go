@@ -0,0 +1,192 @@
+package metrics
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	runnerInfoGauge = prometheus.NewDesc(
+		"github_runner_info",
+		"Self-hosted runner information, one series per runner label",
+		[]string{"scope", "owner", "name", "id", "os", "runner_group", "label"},
+		nil,
+	)
+	runnersCountGauge = prometheus.NewDesc(
+		"github_runners",
+		"Number of self-hosted runners per label, status and busy state",
+		[]string{"scope", "label", "status", "busy"},
+		nil,
+	)
+)
+
+var runnersCollector = newSnapshotCollector(runnersGauge, runnersOrganizationGauge, runnersEnterpriseGauge, runnerInfoGauge, runnersCountGauge)
+
+const (
+	runnerScopeRepo         = "repo"
+	runnerScopeOrganization = "organization"
+	runnerScopeEnterprise   = "enterprise"
+)
+
+const (
+	// runnerGroupsRefreshInterval - how often the runner groups are listed again, they rarely change
+	runnerGroupsRefreshInterval = time.Hour
+)
+
+// runnerGroupsEndpoints - API collector, base path and endpoint names of the runner groups of an organization or an enterprise
+var runnerGroupsEndpoints = map[string]struct {
+	collector, path, groupsEndpoint, runnersEndpoint string
+}{
+	runnerScopeOrganization: {"runners_organization", "orgs", "ListOrganizationRunnerGroups", "ListRunnerGroupRunners"},
+	runnerScopeEnterprise:   {"runners_enterprise", "enterprises", "ListEnterpriseRunnerGroups", "ListEnterpriseRunnerGroupRunners"},
+}
+
+type cachedRunnerGroups struct {
+	fetched time.Time
+	groups  map[int64]string
+}
+
+// runnerGroupsCache - runner group name of every runner, by scope and owner
+var runnerGroupsCache = struct {
+	sync.Mutex
+	owners map[string]*cachedRunnerGroups
+}{owners: make(map[string]*cachedRunnerGroups)}
+
+// listRunnerGroups - same as client.Actions.ListOrganizationRunnerGroups, for the enterprises too
+func listRunnerGroups(scope string, owner string) ([]*github.RunnerGroup, bool) {
+	endpoints := runnerGroupsEndpoints[scope]
+	var groups []*github.RunnerGroup
+	ctx := apiContext(endpoints.collector, endpoints.groupsEndpoint)
+	for page := 1; ; {
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s/%s/actions/runner-groups?per_page=100&page=%d", endpoints.path, owner, page), nil)
+		if err != nil {
+			return nil, false
+		}
+		resp := new(github.RunnerGroups)
+		rr, err := client.Do(ctx, req, resp)
+		if err != nil {
+			log.Printf("%s error for %s %s: %s", endpoints.groupsEndpoint, scope, owner, err.Error())
+			return nil, false
+		}
+
+		groups = append(groups, resp.RunnerGroups...)
+		if rr.NextPage == 0 {
+			break
+		}
+		page = rr.NextPage
+	}
+	return groups, true
+}
+
+// listRunnerGroupRunners - same as client.Actions.ListRunnerGroupRunners, for the enterprises too
+func listRunnerGroupRunners(scope string, owner string, groupId int64) ([]*github.Runner, bool) {
+	endpoints := runnerGroupsEndpoints[scope]
+	var runners []*github.Runner
+	ctx := apiContext(endpoints.collector, endpoints.runnersEndpoint)
+	for page := 1; ; {
+		req, err := client.NewRequest("GET", fmt.Sprintf("%s/%s/actions/runner-groups/%d/runners?per_page=100&page=%d", endpoints.path, owner, groupId, page), nil)
+		if err != nil {
+			return nil, false
+		}
+		resp := new(github.Runners)
+		rr, err := client.Do(ctx, req, resp)
+		if err != nil {
+			log.Printf("%s error for %s %s and group %d: %s", endpoints.runnersEndpoint, scope, owner, groupId, err.Error())
+			return nil, false
+		}
+
+		runners = append(runners, resp.Runners...)
+		if rr.NextPage == 0 {
+			break
+		}
+		page = rr.NextPage
+	}
+	return runners, true
+}
+
+// getRunnerGroupNames - return the runner group name of every runner of an organization or an enterprise, by runner id.
+// The groups are listed every hour, or sooner when a runner isn't in any known group, but at most every workflows cycle.
+// The previous groups are kept when they can't be listed.
+func getRunnerGroupNames(scope string, owner string, runners []*github.Runner) map[int64]string {
+	key := scope + "/" + owner
+	runnerGroupsCache.Lock()
+	cached := runnerGroupsCache.owners[key]
+	runnerGroupsCache.Unlock()
+
+	if cached != nil {
+		age := time.Since(cached.fetched)
+		unknown := false
+		for _, runner := range runners {
+			if _, exists := cached.groups[runner.GetID()]; !exists {
+				unknown = true
+				break
+			}
+		}
+		if age < runnerGroupsRefreshInterval && (!unknown || age < time.Duration(config.Github.Refresh)*5*time.Second) {
+			return cached.groups
+		}
+	}
+
+	res := make(map[int64]string)
+	groups, ok := listRunnerGroups(scope, owner)
+	for _, group := range groups {
+		var groupRunners []*github.Runner
+		if groupRunners, ok = listRunnerGroupRunners(scope, owner, group.GetID()); !ok {
+			break
+		}
+		for _, runner := range groupRunners {
+			res[runner.GetID()] = group.GetName()
+		}
+	}
+	if !ok {
+		if cached != nil {
+			return cached.groups
+		}
+		return res
+	}
+
+	runnerGroupsCache.Lock()
+	runnerGroupsCache.owners[key] = &cachedRunnerGroups{time.Now(), res}
+	runnerGroupsCache.Unlock()
+	return res
+}
+
+// exportRunnersInfo - export the labels of all the runners of a scope, along with the runner count per label.
+// runners and runnerGroups are indexed by owner (repository, organization or enterprise).
+func exportRunnersInfo(series *snapshot, scope string, runners map[string][]*github.Runner, runnerGroups map[string]map[int64]string) {
+	type countKey struct {
+		label, status, busy string
+	}
+	counts := make(map[countKey]float64)
+
+	for owner, ownerRunners := range runners {
+		series.beginScope(owner)
+		for _, runner := range ownerRunners {
+			group := runnerGroups[owner][runner.GetID()]
+			busy := strconv.FormatBool(runner.GetBusy())
+			for _, label := range runner.Labels {
+				series.set(runnerInfoGauge, 1, scope, owner, runner.GetName(), strconv.FormatInt(runner.GetID(), 10), runner.GetOS(), group, label.GetName())
+				counts[countKey{label.GetName(), runner.GetStatus(), busy}]++
+			}
+		}
+	}
+
+	// the counts span every owner, they are kept from the previous snapshot as long as the runners of an owner are
+	series.beginScope("")
+	for owner := range runners {
+		if series.failed(owner) {
+			series.fail()
+		}
+	}
+	for k, v := range counts {
+		series.set(runnersCountGauge, v, scope, k.label, k.status, k.busy)
+	}
+}
@@ -1,10 +1,7 @@
 package metrics
 
 import (
-	"context"
 	"log"
-	"math/rand"
-	"net/http"
 	"strconv"
 	"time"
 
@@ -15,12 +12,11 @@ import (
 )
 
 var (
-	runnersOrganizationGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "github_runner_organization_status",
-			Help: "runner status",
-		},
+	runnersOrganizationGauge = prometheus.NewDesc(
+		"github_runner_organization_status",
+		"runner status",
 		[]string{"organization", "os", "name", "id", "busy"},
+		nil,
 	)
 )
 
@@ -28,21 +24,10 @@ func getAllOrgRunners(orga string) []*github.Runner {
 	var runners []*github.Runner
 	opt := &github.ListOptions{PerPage: 200}
 
+	ctx := apiContext("runners_organization", "ListOrganizationRunners")
 	for {
-		resp, rr, err := client.Actions.ListOrganizationRunners(context.Background(), orga, opt)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("ListOrganizationRunners ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			if rr != nil && rr.StatusCode == http.StatusForbidden {
-				if retryAfterSeconds, e := strconv.ParseInt(rr.Header.Get("Retry-After"), 10, 32); e == nil {
-					delaySeconds := retryAfterSeconds + (60 * rand.Int63n(randomDelaySeconds))
-					log.Printf("ListOrganizationRunners Retry-After %d seconds received, sleeping for %d", retryAfterSeconds, delaySeconds)
-					time.Sleep(time.Duration(delaySeconds) * time.Second)
-					continue
-				}
-			}
+		resp, rr, err := client.Actions.ListOrganizationRunners(ctx, orga, opt)
+		if err != nil {
 			log.Printf("ListOrganizationRunners error for org %s: %s", orga, err.Error())
 			return runners
 		}
@@ -58,19 +43,27 @@ func getAllOrgRunners(orga string) []*github.Runner {
 
 // getRunnersOrganizationFromGithub - return information about runners and their status for an organization
 func getRunnersOrganizationFromGithub() {
+	source := runnersCollector.newSource("runners_organization")
 	for {
+		series := source.newSnapshot()
+		runnersPerOrg := make(map[string][]*github.Runner)
+		runnerGroupsPerOrg := make(map[string]map[int64]string)
 		for _, orga := range config.Github.Organizations.Value() {
+			series.beginScope(orga)
 			runners := getAllOrgRunners(orga)
+			runnersPerOrg[orga] = runners
+			runnerGroupsPerOrg[orga] = getRunnerGroupNames(runnerScopeOrganization, orga, runners)
 			for _, runner := range runners {
 				if runner.GetStatus() == "online" {
-					runnersOrganizationGauge.WithLabelValues(orga, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy())).Set(1)
+					series.set(runnersOrganizationGauge, 1, orga, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy()))
 				} else {
-					runnersOrganizationGauge.WithLabelValues(orga, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy())).Set(0)
+					series.set(runnersOrganizationGauge, 0, orga, *runner.OS, *runner.Name, strconv.FormatInt(runner.GetID(), 10), strconv.FormatBool(runner.GetBusy()))
 				}
 			}
 		}
+		exportRunnersInfo(series, runnerScopeOrganization, runnersPerOrg, runnerGroupsPerOrg)
+		source.publish(series)
 
 		time.Sleep(time.Duration(config.Github.Refresh) * time.Second)
-		runnersOrganizationGauge.Reset()
 	}
 }
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workflowFailureStreakGauge = prometheus.NewDesc(
+		"github_workflow_failure_streak",
+		"Number of consecutive failed runs of a workflow on a branch",
+		[]string{"repo", "workflow", "branch"},
+		nil,
+	)
+	workflowRecoveryTimeHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_workflow_recovery_time_seconds",
+			Help:    "Time (in seconds) between the completion of the first failed run of a failure streak and the completion of the next successful run",
+			Buckets: []float64{300, 900, 1800, 3600, 7200, 14400, 28800, 86400, 172800, 604800},
+		},
+		[]string{"repo", "workflow", "branch"},
+	)
+)
+
+type failureStreak struct {
+	count        int
+	firstFailure time.Time
+	// lastRun - creation time of the last run accounted for
+	lastRun time.Time
+}
+
+// failureStreaks - failure streak of every workflow and branch, kept across cycles.
+// Only used by the workflow runs collector goroutine.
+var failureStreaks = make(map[workflowBranchKey]*failureStreak)
+
+// observeFailureStreaks - account for newly completed runs of a repository, in creation order. The runs completing
+// after a more recent run was accounted for are skipped, they don't belong to the streak anymore.
+func observeFailureStreaks(repo string, runs []*github.WorkflowRun) {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].GetCreatedAt().Before(runs[j].GetCreatedAt().Time)
+	})
+
+	for _, run := range runs {
+		failed := isFailureConclusion(run.GetConclusion())
+		if !failed && run.GetConclusion() != "success" {
+			continue
+		}
+
+		key := workflowBranchKey{repo, run.GetWorkflowID(), run.GetHeadBranch()}
+		streak, exists := failureStreaks[key]
+		if !exists {
+			streak = &failureStreak{}
+			failureStreaks[key] = streak
+		}
+		// re-runs keep the creation time of the run, so a re-run of the last run is still accounted for
+		if run.GetCreatedAt().Before(streak.lastRun) {
+			continue
+		}
+		streak.lastRun = run.GetCreatedAt().Time
+
+		if failed {
+			if streak.count == 0 {
+				streak.firstFailure = run.GetUpdatedAt().Time
+			}
+			streak.count++
+			continue
+		}
+		if streak.count > 0 {
+			workflowRecoveryTimeHistogram.WithLabelValues(repo, getFieldValue(repo, *run, "workflow"), run.GetHeadBranch()).Observe(run.GetUpdatedAt().Sub(streak.firstFailure).Seconds())
+		}
+		streak.count = 0
+	}
+}
+
+// exportFailureStreaks - export the failure streaks of the workflows which still exist
+func exportFailureStreaks(series *snapshot) {
+	for key, streak := range failureStreaks {
+		w, exists := workflows[key.repo][key.workflowId]
+		if !exists {
+			continue
+		}
+		if !isDefaultBranch(key.branch) && time.Since(streak.lastRun) > lastRunsRetention {
+			workflowRecoveryTimeHistogram.DeleteLabelValues(key.repo, w.GetName(), key.branch)
+			delete(failureStreaks, key)
+			continue
+		}
+		series.set(workflowFailureStreakGauge, float64(streak.count), key.repo, w.GetName(), key.branch)
+	}
+}
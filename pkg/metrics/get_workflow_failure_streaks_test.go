@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+func TestObserveFailureStreaks(t *testing.T) {
+	start := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	run := func(id int64, createdMin int, updatedMin int, conclusion string) *github.WorkflowRun {
+		return &github.WorkflowRun{
+			ID:         github.Int64(id),
+			WorkflowID: github.Int64(1),
+			HeadBranch: github.String("main"),
+			Conclusion: github.String(conclusion),
+			CreatedAt:  &github.Timestamp{Time: start.Add(time.Duration(createdMin) * time.Minute)},
+			UpdatedAt:  &github.Timestamp{Time: start.Add(time.Duration(updatedMin) * time.Minute)},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		cycles [][]*github.WorkflowRun
+		want   int
+	}{
+		{
+			name:   "consecutive failures",
+			cycles: [][]*github.WorkflowRun{{run(1, 0, 5, "failure"), run(2, 10, 15, "timed_out")}},
+			want:   2,
+		},
+		{
+			name:   "success resets the streak",
+			cycles: [][]*github.WorkflowRun{{run(1, 0, 5, "failure"), run(2, 10, 15, "success")}},
+			want:   0,
+		},
+		{
+			name:   "other conclusions are ignored",
+			cycles: [][]*github.WorkflowRun{{run(1, 0, 5, "failure"), run(2, 10, 15, "cancelled")}},
+			want:   1,
+		},
+		{
+			name:   "runs of a cycle accounted for in creation order",
+			cycles: [][]*github.WorkflowRun{{run(2, 10, 12, "success"), run(1, 0, 30, "failure")}},
+			want:   0,
+		},
+		{
+			name:   "late failure of an older run is skipped",
+			cycles: [][]*github.WorkflowRun{{run(2, 10, 12, "success")}, {run(1, 0, 30, "failure")}},
+			want:   0,
+		},
+		{
+			name:   "late success of an older run doesn't end the streak",
+			cycles: [][]*github.WorkflowRun{{run(2, 10, 12, "failure")}, {run(1, 0, 30, "success")}},
+			want:   1,
+		},
+		{
+			name:   "re-run of the last run is accounted for",
+			cycles: [][]*github.WorkflowRun{{run(1, 0, 5, "failure")}, {run(1, 0, 20, "success")}},
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failureStreaks = make(map[workflowBranchKey]*failureStreak)
+			defer func() { failureStreaks = make(map[workflowBranchKey]*failureStreak) }()
+			for _, runs := range tt.cycles {
+				observeFailureStreaks("o/r", runs)
+			}
+			if streak := failureStreaks[workflowBranchKey{"o/r", 1, "main"}]; streak == nil || streak.count != tt.want {
+				t.Errorf("got %+v, want a streak of %d", streak, tt.want)
+			}
+		})
+	}
+}
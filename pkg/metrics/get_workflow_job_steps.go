@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// getStepFieldValue return value from step element which corresponds to field
+func getStepFieldValue(repo string, run github.WorkflowRun, job github.WorkflowJob, step github.TaskStep, field string) string {
+	switch field {
+	case "repo", "workflow", "workflow_id", "head_branch", "event", "run_number":
+		return getFieldValue(repo, run, field)
+	case "run_id":
+		return getFieldValue(repo, run, "id")
+	case "job":
+		jobName := job.Name
+		if jobName == nil {
+			return "<empty>"
+		}
+		return *jobName
+	case "job_id":
+		jobId := job.ID
+		if jobId == nil {
+			return "0"
+		}
+		return strconv.FormatInt(*jobId, 10)
+	case "runner_name":
+		runnerName := job.RunnerName
+		if runnerName == nil {
+			return "<empty>"
+		}
+		return *runnerName
+	case "step":
+		stepName := step.Name
+		if stepName == nil {
+			return "<empty>"
+		}
+		return *stepName
+	case "step_number":
+		stepNumber := step.Number
+		if stepNumber == nil {
+			return "0"
+		}
+		return strconv.FormatInt(*stepNumber, 10)
+	case "status":
+		stepStatus := step.Status
+		if stepStatus == nil {
+			return "<empty>"
+		}
+		return *stepStatus
+	case "conclusion":
+		stepConclusion := step.Conclusion
+		if stepConclusion == nil {
+			return "<empty>"
+		}
+		return *stepConclusion
+	}
+	log.Printf("Tried to fetch invalid step field '%s'", field)
+	return ""
+}
+
+func getRelevantStepFields(repo string, run *github.WorkflowRun, job *workflowJob, step *github.TaskStep) []string {
+	relevantFields := strings.Split(config.StepFields, ",")
+	result := make([]string, len(relevantFields))
+	for i, field := range relevantFields {
+		result[i] = getStepFieldValue(repo, *run, job.WorkflowJob, *step, field)
+	}
+	return result
+}
+
+// exportWorkflowJobSteps - export timing and conclusion of every step of a job
+func exportWorkflowJobSteps(series *snapshot, repo string, run *github.WorkflowRun, job *workflowJob) {
+	for _, step := range job.Steps {
+		fields := getRelevantStepFields(repo, run, job, step)
+		series.set(workflowJobStepStatusGauge, getStatusValue(step.GetStatus(), step.GetConclusion()), fields...)
+		if step.GetStatus() == "completed" && step.StartedAt != nil && step.CompletedAt != nil {
+			series.set(workflowJobStepDurationGauge, step.CompletedAt.Sub(step.StartedAt.Time).Seconds(), fields...)
+		}
+	}
+}
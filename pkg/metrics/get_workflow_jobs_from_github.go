@@ -0,0 +1,198 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workflowJobStatusGauge = prometheus.NewDesc(
+		"github_workflow_job_status",
+		"Workflow job status of all jobs belonging to the recent workflow runs",
+		[]string{"repo", "workflow", "run_id", "job_id", "job", "status", "conclusion", "runner_name", "runner_group", "labels"},
+		nil,
+	)
+	workflowJobDurationGauge = prometheus.NewDesc(
+		"github_workflow_job_duration_seconds",
+		"Workflow job duration (in seconds) of all completed jobs belonging to the recent workflow runs",
+		[]string{"repo", "workflow", "run_id", "job_id", "job", "status", "conclusion", "runner_name", "runner_group", "labels"},
+		nil,
+	)
+	workflowJobQueueGauge = prometheus.NewDesc(
+		"github_workflow_job_queue_seconds",
+		"Time (in seconds) jobs belonging to the recent workflow runs waited between their creation and their pickup by a runner",
+		[]string{"repo", "workflow", "run_id", "job_id", "job", "runner_group", "labels"},
+		nil,
+	)
+
+	// completedRunJobs - jobs of completed run attempts, which won't change anymore
+	completedRunJobs = make(map[string][]*workflowJob)
+)
+
+// workflowJob - github.WorkflowJob along with the fields go-github v45 doesn't decode
+type workflowJob struct {
+	github.WorkflowJob
+	CreatedAt  *github.Timestamp `json:"created_at,omitempty"`
+	RunAttempt *int              `json:"run_attempt,omitempty"`
+}
+
+type workflowJobs struct {
+	TotalCount *int           `json:"total_count,omitempty"`
+	Jobs       []*workflowJob `json:"jobs,omitempty"`
+}
+
+// listWorkflowJobs - same as client.Actions.ListWorkflowJobs, but keeps the job creation time
+func listWorkflowJobs(ctx context.Context, owner string, repo string, runId int64, opt *github.ListOptions) (*workflowJobs, *github.Response, error) {
+	u := fmt.Sprintf("repos/%s/%s/actions/runs/%d/jobs?per_page=%d&page=%d", owner, repo, runId, opt.PerPage, opt.Page)
+	req, err := client.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	jobs := new(workflowJobs)
+	resp, err := client.Do(ctx, req, jobs)
+	if err != nil {
+		return nil, resp, err
+	}
+	return jobs, resp, nil
+}
+
+func getAllWorkflowJobs(owner string, repo string, runId int64) []*workflowJob {
+	var jobs []*workflowJob
+	opt := &github.ListOptions{PerPage: 100}
+
+	ctx := apiContext("workflow_jobs", "ListWorkflowJobs")
+	for {
+		jobs_page, resp, err := listWorkflowJobs(ctx, owner, repo, runId, opt)
+		if err != nil {
+			log.Printf("ListWorkflowJobs error for repo %s/%s and runId %d: %s", owner, repo, runId, err.Error())
+			return nil
+		}
+
+		jobs = append(jobs, jobs_page.Jobs...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opt.Page = resp.NextPage
+	}
+
+	return jobs
+}
+
+// getRunJobs - return the jobs of a run attempt which isn't cached yet. The jobs received from the webhook are used
+// as long as they were reconciled recently, the jobs of completed runs are listed from the API once and cached.
+func getRunJobs(owner string, repo string, run *github.WorkflowRun) []*workflowJob {
+	key := getRunKey(run)
+	if webhookEnabled() && run.GetStatus() != "completed" {
+		if jobs, fresh := recentJobs.list(key); fresh {
+			return jobs
+		}
+	}
+
+	jobs := getAllWorkflowJobs(owner, repo, run.GetID())
+	if jobs == nil {
+		jobs, _ = recentJobs.list(key)
+		return jobs
+	}
+	if run.GetStatus() == "completed" {
+		completedRunJobs[key] = jobs
+		recentJobs.delete(key)
+	} else if webhookEnabled() {
+		recentJobs.reconcile(key, jobs)
+		jobs, _ = recentJobs.list(key)
+	}
+	return jobs
+}
+
+func getJobLabels(repo string, workflow string, job *workflowJob) []string {
+	return []string{
+		repo,
+		workflow,
+		strconv.FormatInt(job.GetRunID(), 10),
+		strconv.FormatInt(job.GetID(), 10),
+		job.GetName(),
+		job.GetStatus(),
+		job.GetConclusion(),
+		job.GetRunnerName(),
+		job.GetRunnerGroupName(),
+		strings.Join(job.Labels, ","),
+	}
+}
+
+// workflowJobsEnabled - whether the jobs of the workflow runs are collected
+func workflowJobsEnabled() bool {
+	return config.Metrics.FetchWorkflowJobs || config.Metrics.FetchWorkflowJobSteps
+}
+
+// getWorkflowJobsFromGithub - return informations and status about the jobs of recent workflow runs
+func getWorkflowJobsFromGithub() {
+	if !workflowJobsEnabled() {
+		return
+	}
+	source := workflowJobsCollector.newSource("workflow_jobs")
+	for {
+		series := source.newSnapshot()
+		seen := make(map[string]bool)
+		for _, repo := range repositories {
+			series.beginScope(repo)
+			r := strings.Split(repo, "/")
+			runs := getRecentWorkflowRuns(r[0], r[1])
+
+			// oldest first, so that the last run wins when several runs share a series, like the steps by default
+			for i := len(runs) - 1; i >= 0; i-- {
+				run := runs[i]
+				key := getRunKey(run)
+				jobs, cached := completedRunJobs[key]
+				if !cached {
+					jobs = getRunJobs(r[0], r[1], run)
+				}
+				seen[key] = true
+
+				workflow := getFieldValue(repo, *run, "workflow")
+				for _, job := range jobs {
+					if job.GetStatus() == "completed" {
+						flakiness.record("job/"+strconv.FormatInt(job.GetID(), 10), repo, workflow, job.GetName(), job.GetHeadSHA(), job.GetConclusion(), run.GetCreatedAt().Time)
+					}
+					if config.Metrics.FetchWorkflowJobSteps {
+						exportWorkflowJobSteps(series, repo, run, job)
+					}
+					if !config.Metrics.FetchWorkflowJobs {
+						continue
+					}
+					labels := getJobLabels(repo, workflow, job)
+					series.set(workflowJobStatusGauge, getStatusValue(job.GetStatus(), job.GetConclusion()), labels...)
+					if job.GetStatus() == "completed" && job.StartedAt != nil && job.CompletedAt != nil {
+						series.set(workflowJobDurationGauge, job.CompletedAt.Sub(job.StartedAt.Time).Seconds(), labels...)
+					}
+					if job.GetStatus() != "queued" && job.CreatedAt != nil && job.StartedAt != nil {
+						series.set(workflowJobQueueGauge, job.StartedAt.Sub(job.CreatedAt.Time).Seconds(), repo, workflow, strconv.FormatInt(job.GetRunID(), 10), strconv.FormatInt(job.GetID(), 10), job.GetName(), job.GetRunnerGroupName(), strings.Join(job.Labels, ","))
+					}
+				}
+			}
+		}
+
+		series.beginScope("")
+		flakiness.export(series, true, time.Now().Add(-config.Metrics.WorkflowRunsWindow))
+		source.publish(series)
+
+		// forget runs which left the window
+		for key := range completedRunJobs {
+			if !seen[key] {
+				delete(completedRunJobs, key)
+			}
+		}
+		recentJobs.forget(time.Now().Add(-config.Metrics.WorkflowRunsWindow))
+		saveWorkflowJobsState()
+
+		time.Sleep(time.Duration(config.Github.Refresh) * time.Second)
+	}
+}
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// lastRunsRetention - how long the last run of a workflow on a branch which isn't a default branch is remembered
+	lastRunsRetention = 7 * 24 * time.Hour
+)
+
+var (
+	workflowLastRunGauge = prometheus.NewDesc(
+		"github_workflow_last_run_timestamp_seconds",
+		"Creation time (unix timestamp) of the last run of a workflow on a branch",
+		[]string{"repo", "workflow", "branch"},
+		nil,
+	)
+	workflowLastSuccessGauge = prometheus.NewDesc(
+		"github_workflow_last_success_timestamp_seconds",
+		"Completion time (unix timestamp) of the last successful run of a workflow on a branch",
+		[]string{"repo", "workflow", "branch"},
+		nil,
+	)
+)
+
+type workflowBranchKey struct {
+	repo       string
+	workflowId int64
+	branch     string
+}
+
+type workflowLastRun struct {
+	lastRun, lastSuccess time.Time
+}
+
+// workflowLastRunsState - last run and last success of every workflow and branch, kept past the lookback window
+type workflowLastRunsState struct {
+	mu     sync.Mutex
+	runs   map[workflowBranchKey]*workflowLastRun
+	seeded map[string]bool
+	// defaultBranches - default branch of the repositories, only used by the fetcher when seeding
+	defaultBranches map[string]string
+}
+
+var workflowLastRuns = &workflowLastRunsState{
+	runs:   make(map[workflowBranchKey]*workflowLastRun),
+	seeded: make(map[string]bool),
+
+	defaultBranches: make(map[string]string),
+}
+
+func getLatestWorkflowRun(owner string, repo string, workflowId int64, branch string, status string) *github.WorkflowRun {
+	opt := &github.ListWorkflowRunsOptions{
+		ListOptions: github.ListOptions{PerPage: 1},
+		Branch:      branch,
+		Status:      status,
+	}
+
+	workflow_runs, _, err := client.Actions.ListWorkflowRunsByID(apiContext("workflows", "ListWorkflowRunsByID"), owner, repo, workflowId, opt)
+	if err != nil {
+		log.Printf("ListWorkflowRunsByID error for repo %s/%s and workflow %d: %s", owner, repo, workflowId, err.Error())
+		return nil
+	}
+	if len(workflow_runs.WorkflowRuns) == 0 {
+		return nil
+	}
+	return workflow_runs.WorkflowRuns[0]
+}
+
+// update - account for a workflow run, whichever its age
+func (s *workflowLastRunsState) update(repo string, run *github.WorkflowRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := workflowBranchKey{repo, run.GetWorkflowID(), run.GetHeadBranch()}
+	last, exists := s.runs[key]
+	if !exists {
+		last = &workflowLastRun{}
+		s.runs[key] = last
+	}
+	if created := run.GetCreatedAt().Time; created.After(last.lastRun) {
+		last.lastRun = created
+	}
+	if run.GetStatus() == "completed" && run.GetConclusion() == "success" && run.GetUpdatedAt().After(last.lastSuccess) {
+		last.lastSuccess = run.GetUpdatedAt().Time
+	}
+}
+
+// seed - fetch the last run and the last success on the default branch of the active workflows which were never seen
+// before, so that the workflows which didn't run during the lookback window are exported too
+func (s *workflowLastRunsState) seed(repo string, repoWorkflows map[int64]github.Workflow) {
+	r := strings.Split(repo, "/")
+	branch := ""
+	for id, w := range repoWorkflows {
+		if w.GetState() != "active" {
+			continue
+		}
+		if branch == "" {
+			if branch = s.defaultBranch(r[0], r[1]); branch == "" {
+				return
+			}
+		}
+		seedKey := repo + "/" + strconv.FormatInt(id, 10) + "/" + branch
+		s.mu.Lock()
+		seeded := s.seeded[seedKey]
+		s.mu.Unlock()
+		if seeded {
+			continue
+		}
+
+		if run := getLatestWorkflowRun(r[0], r[1], id, branch, ""); run != nil {
+			s.update(repo, run)
+			if run := getLatestWorkflowRun(r[0], r[1], id, branch, "success"); run != nil {
+				s.update(repo, run)
+			}
+		}
+
+		s.mu.Lock()
+		s.seeded[seedKey] = true
+		s.mu.Unlock()
+	}
+}
+
+// defaultBranch - default branch of a repository, as listed with its organization or else fetched once
+func (s *workflowLastRunsState) defaultBranch(owner string, repo string) string {
+	if branch, exists := repos_per_org[owner].DefaultBranches[owner+"/"+repo]; exists {
+		return branch
+	}
+	if branch, exists := s.defaultBranches[owner+"/"+repo]; exists {
+		return branch
+	}
+	repository, _, err := client.Repositories.Get(apiContext("workflows", "GetRepository"), owner, repo)
+	if err != nil {
+		log.Printf("GetRepository error for %s/%s: %s", owner, repo, err.Error())
+		return ""
+	}
+	s.defaultBranches[owner+"/"+repo] = repository.GetDefaultBranch()
+	return repository.GetDefaultBranch()
+}
+
+// export - export the last runs of the workflows which still exist
+func (s *workflowLastRunsState) export(series *snapshot) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, last := range s.runs {
+		w, exists := workflows[key.repo][key.workflowId]
+		if !exists {
+			continue
+		}
+		if !isDefaultBranch(key.branch) && time.Since(last.lastRun) > lastRunsRetention {
+			delete(s.runs, key)
+			continue
+		}
+
+		series.set(workflowLastRunGauge, float64(last.lastRun.Unix()), key.repo, w.GetName(), key.branch)
+		if !last.lastSuccess.IsZero() {
+			series.set(workflowLastSuccessGauge, float64(last.lastSuccess.Unix()), key.repo, w.GetName(), key.branch)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+func TestWorkflowLastRunsSeed(t *testing.T) {
+	created := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		name          string
+		reposPerOrg   map[string]orgRepos
+		wantRequests  []string
+		wantBranch    string
+		alreadySeeded bool
+	}{
+		{
+			name:        "default branch listed with the organization",
+			reposPerOrg: map[string]orgRepos{"o": {Active: []string{"o/r"}, DefaultBranches: map[string]string{"o/r": "develop"}}},
+			wantRequests: []string{
+				"/repos/o/r/actions/workflows/1/runs?branch=develop&per_page=1",
+				"/repos/o/r/actions/workflows/1/runs?branch=develop&per_page=1&status=success",
+			},
+			wantBranch: "develop",
+		},
+		{
+			name: "default branch of a configured repository",
+			wantRequests: []string{
+				"/repos/o/r",
+				"/repos/o/r/actions/workflows/1/runs?branch=trunk&per_page=1",
+				"/repos/o/r/actions/workflows/1/runs?branch=trunk&per_page=1&status=success",
+			},
+			wantBranch: "trunk",
+		},
+		{
+			name:          "already seeded",
+			reposPerOrg:   map[string]orgRepos{"o": {Active: []string{"o/r"}, DefaultBranches: map[string]string{"o/r": "develop"}}},
+			alreadySeeded: true,
+			wantBranch:    "develop",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resetStateGlobals()
+			repos_per_org = test.reposPerOrg
+			if test.alreadySeeded {
+				workflowLastRuns.seeded["o/r/1/"+test.wantBranch] = true
+			}
+			var requests []string
+			newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				requests = append(requests, r.URL.RequestURI())
+				w.Header().Set("Content-Type", "application/json")
+				if r.URL.Path == "/repos/o/r" {
+					json.NewEncoder(w).Encode(github.Repository{DefaultBranch: github.String("trunk")})
+					return
+				}
+				json.NewEncoder(w).Encode(github.WorkflowRuns{WorkflowRuns: []*github.WorkflowRun{{
+					WorkflowID: github.Int64(1),
+					HeadBranch: github.String(r.URL.Query().Get("branch")),
+					CreatedAt:  &github.Timestamp{Time: created},
+				}}})
+			})
+
+			workflowLastRuns.seed("o/r", map[int64]github.Workflow{
+				1: {ID: github.Int64(1), State: github.String("active")},
+				2: {ID: github.Int64(2), State: github.String("disabled_manually")},
+			})
+
+			if len(requests) != len(test.wantRequests) {
+				t.Fatalf("got requests %v, want %v", requests, test.wantRequests)
+			}
+			for i := range requests {
+				if requests[i] != test.wantRequests[i] {
+					t.Errorf("got requests %v, want %v", requests, test.wantRequests)
+				}
+			}
+			if !workflowLastRuns.seeded["o/r/1/"+test.wantBranch] || workflowLastRuns.seeded["o/r/2/"+test.wantBranch] {
+				t.Errorf("got seeded %v", workflowLastRuns.seeded)
+			}
+			if !test.alreadySeeded && workflowLastRuns.runs[workflowBranchKey{"o/r", 1, test.wantBranch}] == nil {
+				t.Errorf("got runs %v", workflowLastRuns.runs)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"log"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workflowRunAttemptsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_workflow_run_attempts_total",
+			Help: "Number of completed workflow run attempts, including the re-runs",
+		},
+		[]string{"repo", "workflow", "branch_class"},
+	)
+	workflowRunsRetriedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_workflow_runs_retried_total",
+			Help: "Number of workflow runs which needed more than one attempt",
+		},
+		[]string{"repo", "workflow", "branch_class"},
+	)
+	workflowRunsRecoveredCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_workflow_runs_recovered_total",
+			Help: "Number of workflow runs which failed and then succeeded on a re-run",
+		},
+		[]string{"repo", "workflow", "branch_class"},
+	)
+)
+
+type attemptConclusion struct {
+	conclusion string
+	created    time.Time
+}
+
+var (
+	// attemptConclusions - conclusion of the completed run attempts, by run key
+	attemptConclusions = make(map[string]attemptConclusion)
+	// retriedRuns - creation time of the runs already counted as retried, by run id
+	retriedRuns = make(map[int64]time.Time)
+)
+
+// isFailureConclusion - whether the conclusion means the run or job failed, as opposed to being cancelled or skipped
+func isFailureConclusion(conclusion string) bool {
+	switch conclusion {
+	case "failure", "timed_out", "startup_failure":
+		return true
+	}
+	return false
+}
+
+func getWorkflowRunAttempt(owner string, repo string, runId int64, attempt int) *github.WorkflowRun {
+	run, _, err := client.Actions.GetWorkflowRunAttempt(apiContext("workflow_runs", "GetWorkflowRunAttempt"), owner, repo, runId, attempt, nil)
+	if err != nil {
+		log.Printf("GetWorkflowRunAttempt error for repo %s/%s, runId %d and attempt %d: %s", owner, repo, runId, attempt, err.Error())
+		return nil
+	}
+	return run
+}
+
+// getPreviousAttemptConclusion - return the conclusion of the attempt preceding the given run attempt
+func getPreviousAttemptConclusion(owner string, repo string, run *github.WorkflowRun) string {
+	key := getRunAttemptKey(run.GetID(), run.GetRunAttempt()-1)
+	if previous, exists := attemptConclusions[key]; exists {
+		return previous.conclusion
+	}
+
+	previous := getWorkflowRunAttempt(owner, repo, run.GetID(), run.GetRunAttempt()-1)
+	if previous == nil {
+		return ""
+	}
+	attemptConclusions[key] = attemptConclusion{previous.GetConclusion(), run.GetCreatedAt().Time}
+	return previous.GetConclusion()
+}
+
+// observeRunAttempt - account for a completed run attempt, it must be called once per attempt
+func observeRunAttempt(owner string, repo string, workflow string, run *github.WorkflowRun) {
+	labels := []string{owner + "/" + repo, workflow, getBranchClass(run)}
+	incPersistedCounter(workflowRunAttemptsCounter, labels...)
+	attemptConclusions[getRunKey(run)] = attemptConclusion{run.GetConclusion(), run.GetCreatedAt().Time}
+
+	if run.GetRunAttempt() <= 1 {
+		return
+	}
+	if _, exists := retriedRuns[run.GetID()]; !exists {
+		incPersistedCounter(workflowRunsRetriedCounter, labels...)
+		retriedRuns[run.GetID()] = run.GetCreatedAt().Time
+	}
+	previous := getPreviousAttemptConclusion(owner, repo, run)
+	flakiness.record(getRunAttemptKey(run.GetID(), run.GetRunAttempt()-1), labels[0], workflow, "", run.GetHeadSHA(), previous, run.GetCreatedAt().Time)
+	if run.GetConclusion() == "success" && isFailureConclusion(previous) {
+		incPersistedCounter(workflowRunsRecoveredCounter, labels...)
+	}
+}
+
+// forgetRunAttempts - drop the attempts of the runs created before the given time
+func forgetRunAttempts(before time.Time) {
+	for key, attempt := range attemptConclusions {
+		if attempt.created.Before(before) {
+			delete(attemptConclusions, key)
+		}
+	}
+	for runId, created := range retriedRuns {
+		if created.Before(before) {
+			delete(retriedRuns, runId)
+		}
+	}
+}
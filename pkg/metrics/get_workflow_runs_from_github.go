@@ -2,11 +2,8 @@ package metrics
 
 import (
 	"bytes"
-	"context"
 	"encoding/json"
 	"log"
-	"math/rand"
-	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -14,6 +11,17 @@ import (
 	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
 
 	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workflowRunsCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_workflow_runs_total",
+			Help: "Number of completed workflow run attempts",
+		},
+		[]string{"repo", "workflow", "conclusion", "event"},
+	)
 )
 
 // getFieldValue return value from run element which corresponds to field
@@ -51,6 +59,12 @@ func getFieldValue(repo string, run github.WorkflowRun, field string) string {
 			return "0"
 		}
 		return strconv.Itoa(*runNumber)
+	case "run_attempt":
+		runAttempt := run.RunAttempt
+		if runAttempt == nil {
+			return "0"
+		}
+		return strconv.Itoa(*runAttempt)
 	case "workflow_id":
 		workflowId := run.WorkflowID
 		if workflowId == nil {
@@ -86,6 +100,12 @@ func getFieldValue(repo string, run github.WorkflowRun, field string) string {
 			return "<empty>"
 		}
 		return *runStatus
+	case "conclusion":
+		runConclusion := run.Conclusion
+		if runConclusion == nil {
+			return "<empty>"
+		}
+		return *runConclusion
 	}
 	log.Printf("Tried to fetch invalid field '%s'", field)
 	return ""
@@ -93,6 +113,62 @@ func getFieldValue(repo string, run github.WorkflowRun, field string) string {
 
 var debug = false
 
+// getStatusValue - map a run, job or step status and conclusion to the values of github_workflow_run_status.
+// The conclusion is only meaningful once the status is completed.
+func getStatusValue(status string, conclusion string) float64 {
+	switch status {
+	case "in_progress":
+		return 3
+	case "queued":
+		return 4
+	case "requested", "waiting", "pending":
+		return 11
+	}
+	switch conclusion {
+	case "success":
+		return 1
+	case "skipped":
+		return 2
+	case "cancelled":
+		return 5
+	case "timed_out":
+		return 6
+	case "action_required":
+		return 7
+	case "neutral":
+		return 8
+	case "stale":
+		return 9
+	case "startup_failure":
+		return 10
+	}
+	return 0
+}
+
+// completedRuns - run attempts already observed by the cumulative workflow run metrics
+var completedRuns = newRunTracker()
+
+// getBranchClass - classify the run branch, to keep the cardinality of the aggregated metrics bounded
+func getBranchClass(run *github.WorkflowRun) string {
+	switch run.GetEvent() {
+	case "pull_request", "pull_request_target":
+		return "pull_request"
+	}
+	if isDefaultBranch(run.GetHeadBranch()) {
+		return "default"
+	}
+	return "other"
+}
+
+func isDefaultBranch(branch string) bool {
+	for _, b := range config.Metrics.DefaultBranches.Value() {
+		if branch == b {
+			return true
+		}
+	}
+	return false
+}
+
 func getRelevantFields(repo string, run *github.WorkflowRun) []string {
 	relevantFields := strings.Split(config.WorkflowFields, ",")
 	if debug {
@@ -120,32 +196,33 @@ func getRelevantFields(repo string, run *github.WorkflowRun) []string {
 	return result
 }
 
+// getRecentWorkflowRuns - return the workflow runs created in the lookback window, fetching only what changed since the last call
 func getRecentWorkflowRuns(owner string, repo string) []*github.WorkflowRun {
-	// FIXME: make the window dynamic
-	window_start := time.Now().Add(time.Duration(-8) * time.Hour).Format(time.RFC3339)
+	rr := recentRuns.get(owner + "/" + repo)
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+
+	rr.mergePending()
+	rr.sync(owner, repo)
+	return rr.list(time.Now().Add(-config.Metrics.WorkflowRunsWindow))
+}
+
+// listWorkflowRunsCreatedSince - return the workflow runs created since the given time, only the ones with the given
+// status unless it is empty, and whether all of them could be listed
+func listWorkflowRunsCreatedSince(owner string, repo string, since time.Time, status string) ([]*github.WorkflowRun, bool) {
 	opt := &github.ListWorkflowRunsOptions{
-		ListOptions: github.ListOptions{PerPage: 100},
-		Created:     ">=" + window_start,
+		ListOptions: github.ListOptions{PerPage: runsPerPage},
+		Created:     ">=" + since.UTC().Format(time.RFC3339),
+		Status:      status,
 	}
 
 	var runs []*github.WorkflowRun
+	ctx := apiContext("workflow_runs", "ListRepositoryWorkflowRuns")
 	for {
-		workflow_runs, response, err := client.Actions.ListRepositoryWorkflowRuns(context.Background(), owner, repo, opt)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("ListRepositoryWorkflowRuns ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			if response != nil && response.StatusCode == http.StatusForbidden {
-				if retryAfterSeconds, e := strconv.ParseInt(response.Header.Get("Retry-After"), 10, 32); e == nil {
-					delaySeconds := retryAfterSeconds + (60 * rand.Int63n(randomDelaySeconds))
-					log.Printf("ListRepositoryWorkflowRuns Retry-After %d seconds received, sleeping for %d", retryAfterSeconds, delaySeconds)
-					time.Sleep(time.Duration(delaySeconds) * time.Second)
-					continue
-				}
-			}
+		workflow_runs, response, err := client.Actions.ListRepositoryWorkflowRuns(ctx, owner, repo, opt)
+		if err != nil {
 			log.Printf("ListRepositoryWorkflowRuns error for repo %s/%s: %s", owner, repo, err)
-			return runs
+			return runs, false
 		}
 
 		runs = append(runs, workflow_runs.WorkflowRuns...)
@@ -155,61 +232,99 @@ func getRecentWorkflowRuns(owner string, repo string) []*github.WorkflowRun {
 		opt.Page = response.NextPage
 	}
 
-	return runs
+	return runs, true
 }
 
-func getRunUsage(owner string, repo string, runId int64) *github.WorkflowRunUsage {
-	for {
-		resp, _, err := client.Actions.GetWorkflowRunUsageByID(context.Background(), owner, repo, runId)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("GetWorkflowRunUsageByID ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			log.Printf("GetWorkflowRunUsageByID error for repo %s/%s and runId %d: %s", owner, repo, runId, err.Error())
-			return nil
+// getWorkflowRun - fetch a workflow run on behalf of the given collector
+func getWorkflowRun(collector string, owner string, repo string, runId int64) *github.WorkflowRun {
+	run, _, err := client.Actions.GetWorkflowRunByID(apiContext(collector, "GetWorkflowRunByID"), owner, repo, runId)
+	if err != nil {
+		log.Printf("GetWorkflowRunByID error for repo %s/%s and runId %d: %s", owner, repo, runId, err.Error())
+		return nil
+	}
+	return run
+}
+
+// getRunDurationMs - return the duration of the last attempt of a run, from the usage API when it is enabled
+func getRunDurationMs(owner string, repo string, run *github.WorkflowRun) float64 {
+	if config.Metrics.FetchWorkflowRunUsage {
+		if usage := getRunUsage(owner, repo, run.GetID()); usage != nil {
+			return float64(usage.GetRunDurationMS())
 		}
-		return resp
 	}
+	// Fallback for Github Enterprise, re-run attempts keep the creation time of the run but start at RunStartedAt
+	started := run.GetCreatedAt().Time
+	if run.RunStartedAt != nil {
+		started = run.RunStartedAt.Time
+	}
+	return float64(run.GetUpdatedAt().Sub(started).Milliseconds())
+}
+
+func getRunUsage(owner string, repo string, runId int64) *github.WorkflowRunUsage {
+	resp, _, err := client.Actions.GetWorkflowRunUsageByID(apiContext("workflow_runs", "GetWorkflowRunUsageByID"), owner, repo, runId)
+	if err != nil {
+		log.Printf("GetWorkflowRunUsageByID error for repo %s/%s and runId %d: %s", owner, repo, runId, err.Error())
+		return nil
+	}
+	return resp
 }
 
 // getWorkflowRunsFromGithub - return informations and status about a workflow
 func getWorkflowRunsFromGithub() {
+	source := workflowRunsCollector.newSource("workflow_runs")
 	for {
+		series := source.newSnapshot()
 		for _, repo := range repositories {
+			series.beginScope(repo)
 			r := strings.Split(repo, "/")
 			runs := getRecentWorkflowRuns(r[0], r[1])
 
+			stateMu.Lock()
+			var completed []*github.WorkflowRun
 			for _, run := range runs {
-				var s float64 = 0
-				if run.GetConclusion() == "success" {
-					s = 1
-				} else if run.GetConclusion() == "skipped" {
-					s = 2
-				} else if run.GetConclusion() == "in_progress" {
-					s = 3
-				} else if run.GetConclusion() == "queued" {
-					s = 4
-				}
-
 				fields := getRelevantFields(repo, run)
 
-				workflowRunStatusGauge.WithLabelValues(fields...).Set(s)
+				series.set(workflowRunStatusGauge, getStatusValue(run.GetStatus(), run.GetConclusion()), fields...)
+				series.set(workflowRunAttemptGauge, float64(run.GetRunAttempt()), fields...)
+				workflowLastRuns.update(repo, run)
+
+				// re-run attempts keep the original creation time, so only the first attempt tells the queue time
+				if run.RunStartedAt != nil && run.CreatedAt != nil && run.GetRunAttempt() <= 1 {
+					series.set(workflowRunQueueGauge, run.RunStartedAt.Sub(run.CreatedAt.Time).Seconds(), fields...)
+				}
 
-				var run_usage *github.WorkflowRunUsage = nil
-				if config.Metrics.FetchWorkflowRunUsage {
-					run_usage = getRunUsage(r[0], r[1], *run.ID)
+				newlyCompleted := completedRuns.markCompleted(run)
+				// the duration is only needed for the gauge, or once per completed run attempt
+				var durationMs float64
+				if config.Metrics.ExportRunDurationGauge || newlyCompleted {
+					durationMs = getRunDurationMs(r[0], r[1], run)
 				}
-				if run_usage == nil { // Fallback for Github Enterprise
-					created := run.CreatedAt.Time.Unix()
-					updated := run.UpdatedAt.Time.Unix()
-					elapsed := updated - created
-					workflowRunDurationGauge.WithLabelValues(fields...).Set(float64(elapsed * 1000))
-				} else {
-					workflowRunDurationGauge.WithLabelValues(fields...).Set(float64(run_usage.GetRunDurationMS()))
+				if config.Metrics.ExportRunDurationGauge {
+					series.set(workflowRunDurationGauge, durationMs, fields...)
+				}
+
+				if newlyCompleted {
+					workflow := getFieldValue(repo, *run, "workflow")
+					workflowRunDurationHistogram.WithLabelValues(repo, workflow, getBranchClass(run), run.GetConclusion()).Observe(durationMs / 1000)
+					incPersistedCounter(workflowRunsCounter, repo, workflow, run.GetConclusion(), run.GetEvent())
+					flakiness.record(getRunKey(run), repo, workflow, "", run.GetHeadSHA(), run.GetConclusion(), run.GetCreatedAt().Time)
+					observeRunAttempt(r[0], r[1], workflow, run)
+					completed = append(completed, run)
 				}
 			}
+			observeFailureStreaks(repo, completed)
+			stateMu.Unlock()
 		}
+		stateMu.Lock()
+		series.beginScope("")
+		flakiness.export(series, false, time.Now().Add(-config.Metrics.WorkflowRunsWindow))
+		workflowLastRuns.export(series)
+		exportFailureStreaks(series)
+		source.publish(series)
+		completedRuns.forget(time.Now().Add(-2 * config.Metrics.WorkflowRunsWindow))
+		forgetRunAttempts(time.Now().Add(-2 * config.Metrics.WorkflowRunsWindow))
+		saveWorkflowRunsState()
+		stateMu.Unlock()
 
 		time.Sleep(time.Duration(config.Github.Refresh) * time.Second)
 	}
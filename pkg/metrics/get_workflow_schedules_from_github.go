@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/robfig/cron/v3"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+const (
+	// scheduleGracePeriod - how late a scheduled run can start before its fire time is counted as missed
+	scheduleGracePeriod = 30 * time.Minute
+)
+
+var (
+	workflowScheduleExpectedGauge = prometheus.NewDesc(
+		"github_workflow_schedule_expected_runs",
+		"Number of scheduled runs a workflow should have had in the lookback window according to its cron expressions",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	workflowScheduleMissedGauge = prometheus.NewDesc(
+		"github_workflow_schedule_missed_runs",
+		"Number of expected scheduled runs of a workflow in the lookback window without a matching schedule run",
+		[]string{"repo", "workflow"},
+		nil,
+	)
+	workflowScheduleLatenessHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_workflow_schedule_lateness_seconds",
+			Help:    "Time (in seconds) between the fire time of a cron expression and the creation of the schedule run",
+			Buckets: []float64{60, 300, 600, 900, 1800, 3600, 7200, 14400},
+		},
+		[]string{"repo", "workflow"},
+	)
+)
+
+var workflowSchedulesCollector = newSnapshotCollector(workflowScheduleExpectedGauge, workflowScheduleMissedGauge)
+
+// scheduledRuns - creation time of the schedule runs whose lateness was already observed, by run id.
+// Only used by the workflow schedules collector goroutine.
+var scheduledRuns = make(map[int64]time.Time)
+
+// getScheduleFireTimes - return the sorted fire times of the cron expressions between from and to.
+// The cron expressions of GitHub Actions are always evaluated in UTC.
+func getScheduleFireTimes(crons []string, from time.Time, to time.Time) []time.Time {
+	seen := make(map[time.Time]bool)
+	var times []time.Time
+	for _, spec := range crons {
+		schedule, err := cron.ParseStandard(spec)
+		if err != nil {
+			log.Printf("Couldn't parse cron expression \"%s\": %s", spec, err.Error())
+			continue
+		}
+		// Next returns the first fire time strictly after the given time
+		for t := schedule.Next(from.UTC().Add(-time.Second)); !t.IsZero() && !t.After(to); t = schedule.Next(t) {
+			if !seen[t] {
+				seen[t] = true
+				times = append(times, t)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times
+}
+
+// countMissedSchedules - match every fire time with the first schedule run created before the next fire time,
+// and return the number of fire times left without a run
+func countMissedSchedules(times []time.Time, runs []*github.WorkflowRun, now time.Time) int {
+	missed := 0
+	for i, t := range times {
+		next := now
+		if i+1 < len(times) {
+			next = times[i+1]
+		}
+		matched := false
+		for _, run := range runs {
+			created := run.GetCreatedAt().Time
+			if !created.Before(t) && created.Before(next) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			missed++
+		}
+	}
+	return missed
+}
+
+// observeScheduleLateness - observe the lateness of the schedule runs which weren't observed yet
+func observeScheduleLateness(repo string, workflow string, crons []string, runs []*github.WorkflowRun) {
+	for _, run := range runs {
+		if _, exists := scheduledRuns[run.GetID()]; exists {
+			continue
+		}
+		created := run.GetCreatedAt().Time
+		// the fire time of a run is the last one before its creation, looking back as far as the lookback window
+		times := getScheduleFireTimes(crons, created.Add(-config.Metrics.WorkflowRunsWindow), created)
+		if len(times) == 0 {
+			continue
+		}
+		scheduledRuns[run.GetID()] = created
+		workflowScheduleLatenessHistogram.WithLabelValues(repo, workflow).Observe(created.Sub(times[len(times)-1]).Seconds())
+	}
+}
+
+func getWorkflowSchedulesFromGithub() {
+	if !config.Metrics.FetchWorkflowFiles {
+		return
+	}
+
+	source := workflowSchedulesCollector.newSource("workflow_schedules", "workflow_files")
+	for {
+		series := source.newSnapshot()
+		now := time.Now()
+		windowStart := now.Add(-config.Metrics.WorkflowRunsWindow)
+		for repo, repoWorkflows := range workflows {
+			series.beginScope(repo)
+			r := strings.Split(repo, "/")
+			var runs []*github.WorkflowRun
+			for _, w := range repoWorkflows {
+				if w.GetState() != "active" {
+					continue
+				}
+				file := getWorkflowFile(r[0], r[1], w.GetPath())
+				if file == nil || len(file.schedules) == 0 {
+					continue
+				}
+				if runs == nil {
+					runs = getRecentWorkflowRuns(r[0], r[1])
+				}
+
+				var scheduled []*github.WorkflowRun
+				for _, run := range runs {
+					if run.GetWorkflowID() == w.GetID() && run.GetEvent() == "schedule" {
+						scheduled = append(scheduled, run)
+					}
+				}
+				observeScheduleLateness(repo, w.GetName(), file.schedules, scheduled)
+
+				// the fire times before the last update of the workflow may belong to other cron expressions
+				from := windowStart
+				if updated := w.GetUpdatedAt().Time; updated.After(from) {
+					from = updated
+				}
+				times := getScheduleFireTimes(file.schedules, from, now.Add(-scheduleGracePeriod))
+				series.set(workflowScheduleExpectedGauge, float64(len(times)), repo, w.GetName())
+				series.set(workflowScheduleMissedGauge, float64(countMissedSchedules(times, scheduled, now)), repo, w.GetName())
+			}
+		}
+		source.publish(series)
+
+		for runId, created := range scheduledRuns {
+			if created.Before(now.Add(-2 * config.Metrics.WorkflowRunsWindow)) {
+				delete(scheduledRuns, runId)
+			}
+		}
+
+		time.Sleep(time.Duration(config.Github.Refresh) * 5 * time.Second)
+	}
+}
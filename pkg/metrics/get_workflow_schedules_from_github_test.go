@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+func TestGetScheduleFireTimes(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	at := func(day int, hour int, min int) time.Time { return time.Date(2024, 5, day, hour, min, 0, 0, time.UTC) }
+
+	tests := []struct {
+		name  string
+		crons []string
+		from  time.Time
+		to    time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "single expression",
+			crons: []string{"0 9 * * *"},
+			from:  from,
+			to:    at(3, 0, 0),
+			want:  []time.Time{at(1, 9, 0), at(2, 9, 0)},
+		},
+		{
+			name:  "fire times at the bounds are included",
+			crons: []string{"0 9 * * *"},
+			from:  at(1, 9, 0),
+			to:    at(2, 9, 0),
+			want:  []time.Time{at(1, 9, 0), at(2, 9, 0)},
+		},
+		{
+			name:  "several schedule entries are merged and sorted",
+			crons: []string{"0 18 * * *", "0 6 * * *"},
+			from:  from,
+			to:    at(2, 0, 0),
+			want:  []time.Time{at(1, 6, 0), at(1, 18, 0)},
+		},
+		{
+			name:  "overlapping schedule entries fire once",
+			crons: []string{"0 */6 * * *", "0 12 * * *"},
+			from:  from,
+			to:    at(1, 13, 0),
+			want:  []time.Time{at(1, 0, 0), at(1, 6, 0), at(1, 12, 0)},
+		},
+		{
+			name:  "invalid expressions are skipped",
+			crons: []string{"not a cron", "0 9 * * *", "61 * * * *"},
+			from:  from,
+			to:    at(2, 0, 0),
+			want:  []time.Time{at(1, 9, 0)},
+		},
+		{
+			name:  "expressions with an invalid timezone are skipped",
+			crons: []string{"CRON_TZ=Not/AZone 0 6 * * *", "0 9 * * *"},
+			from:  from,
+			to:    at(2, 0, 0),
+			want:  []time.Time{at(1, 9, 0)},
+		},
+		{
+			name:  "only invalid expressions",
+			crons: []string{"* * *"},
+			from:  from,
+			to:    at(2, 0, 0),
+		},
+		{
+			name:  "evaluated in UTC whatever the timezone of the bounds",
+			crons: []string{"0 9 * * *"},
+			from:  from.In(time.FixedZone("UTC-5", -5*3600)),
+			to:    at(2, 0, 0).In(time.FixedZone("UTC+2", 2*3600)),
+			want:  []time.Time{at(1, 9, 0)},
+		},
+		{
+			name:  "no fire time in the window",
+			crons: []string{"0 0 1 1 *"},
+			from:  from,
+			to:    at(31, 0, 0),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getScheduleFireTimes(tt.crons, tt.from, tt.to)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if !got[i].Equal(tt.want[i]) || got[i].Location() != time.UTC {
+					t.Errorf("got %v, want %v", got, tt.want)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestCountMissedSchedules(t *testing.T) {
+	at := func(hour int, min int) time.Time { return time.Date(2024, 5, 1, hour, min, 0, 0, time.UTC) }
+	run := func(created time.Time) *github.WorkflowRun {
+		return &github.WorkflowRun{CreatedAt: &github.Timestamp{Time: created}}
+	}
+	times := []time.Time{at(6, 0), at(12, 0), at(18, 0)}
+
+	tests := []struct {
+		name string
+		runs []*github.WorkflowRun
+		now  time.Time
+		want int
+	}{
+		{"no run", nil, at(20, 0), 3},
+		{"a run per fire time", []*github.WorkflowRun{run(at(6, 5)), run(at(12, 30)), run(at(18, 1))}, at(20, 0), 0},
+		{"late run matched before the next fire time", []*github.WorkflowRun{run(at(11, 59)), run(at(12, 0)), run(at(18, 0))}, at(20, 0), 0},
+		{"several runs between two fire times count once", []*github.WorkflowRun{run(at(6, 0)), run(at(7, 0)), run(at(18, 0))}, at(20, 0), 1},
+		{"run before the first fire time", []*github.WorkflowRun{run(at(5, 59))}, at(20, 0), 3},
+		{"last fire time matched until now", []*github.WorkflowRun{run(at(6, 0)), run(at(12, 0)), run(at(19, 0))}, at(18, 30), 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := countMissedSchedules(times, tt.runs, tt.now); got != tt.want {
+				t.Errorf("got %d missed, want %d", got, tt.want)
+			}
+		})
+	}
+}
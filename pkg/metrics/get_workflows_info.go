@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"strconv"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	workflowInfoGauge = prometheus.NewDesc(
+		"github_workflow_info",
+		"Workflow definition information, always set to 1",
+		[]string{"repo", "workflow", "id", "path", "state"},
+		nil,
+	)
+	workflowUpdatedGauge = prometheus.NewDesc(
+		"github_workflow_updated_timestamp_seconds",
+		"Last update time (unix timestamp) of a workflow definition",
+		[]string{"repo", "workflow", "id"},
+		nil,
+	)
+)
+
+var workflowsCollector = newSnapshotCollector(workflowInfoGauge, workflowUpdatedGauge)
+
+// exportWorkflowsInfo - export the definition of every workflow of the workflow cache
+func exportWorkflowsInfo(series *snapshot, ww map[string]map[int64]github.Workflow) {
+	for repo, workflows_for_repo := range ww {
+		// the workflows of the repositories which couldn't be listed are already kept by the fetcher
+		series.beginScope(repo)
+		for id, w := range workflows_for_repo {
+			workflowId := strconv.FormatInt(id, 10)
+			series.set(workflowInfoGauge, 1, repo, w.GetName(), workflowId, w.GetPath(), w.GetState())
+			if w.UpdatedAt != nil {
+				series.set(workflowUpdatedGauge, float64(w.UpdatedAt.Unix()), repo, w.GetName(), workflowId)
+			}
+		}
+	}
+}
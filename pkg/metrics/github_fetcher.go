@@ -1,11 +1,7 @@
 package metrics
 
 import (
-	"context"
 	"log"
-	"math/rand"
-	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -17,6 +13,8 @@ import (
 type orgRepos struct {
 	Active, Inactive, Forks []string
 	Count                   int
+	// DefaultBranches - default branch of every active repository
+	DefaultBranches map[string]string
 }
 
 var (
@@ -25,31 +23,22 @@ var (
 	workflows     map[string]map[int64]github.Workflow
 )
 
-const (
-	randomDelaySeconds int64 = 5
-)
-
 func countAllReposForOrg(orga string) int {
-	for {
-		organization, _, err := client.Organizations.Get(context.Background(), orga)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("Organizations ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			log.Printf("Get error for %s: %s", orga, err.Error())
-			break
-		}
-		log.Printf("*organization.PublicRepos: %d", *organization.PublicRepos)
-		log.Printf("*organization.TotalPrivateRepos: %d", *organization.TotalPrivateRepos)
-		log.Printf("*organization.OwnedPrivateRepos: %d", *organization.OwnedPrivateRepos)
-		return *organization.PublicRepos + *organization.OwnedPrivateRepos
+	organization, _, err := client.Organizations.Get(apiContext("workflows", "GetOrganization"), orga)
+	if err != nil {
+		log.Printf("Get error for %s: %s", orga, err.Error())
+		return -1
 	}
-	return -1
+	log.Printf("*organization.PublicRepos: %d", *organization.PublicRepos)
+	log.Printf("*organization.TotalPrivateRepos: %d", *organization.TotalPrivateRepos)
+	log.Printf("*organization.OwnedPrivateRepos: %d", *organization.OwnedPrivateRepos)
+	return *organization.PublicRepos + *organization.OwnedPrivateRepos
 }
 
-func getAllReposForOrg(orga string) orgRepos {
+// getAllReposForOrg - return the repositories of the organization, and whether all of them could be listed
+func getAllReposForOrg(orga string) (orgRepos, bool) {
 	var active_repos, inactive_repos, forks []string
+	default_branches := make(map[string]string)
 
 	opt := &github.RepositoryListByOrgOptions{
 		ListOptions: github.ListOptions{
@@ -57,15 +46,12 @@ func getAllReposForOrg(orga string) orgRepos {
 			Page:    0,
 		},
 	}
+	ctx := apiContext("workflows", "ListByOrg")
 	for {
-		repos_page, resp, err := client.Repositories.ListByOrg(context.Background(), orga, opt)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("ListByOrg ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
+		repos_page, resp, err := client.Repositories.ListByOrg(ctx, orga, opt)
+		if err != nil {
 			log.Printf("ListByOrg error for %s: %s", orga, err.Error())
-			break
+			return orgRepos{}, false
 		}
 		for _, repo := range repos_page {
 			if *repo.Fork {
@@ -80,6 +66,7 @@ func getAllReposForOrg(orga string) orgRepos {
 				continue
 			}
 			active_repos = append(active_repos, *repo.FullName)
+			default_branches[*repo.FullName] = repo.GetDefaultBranch()
 		}
 		if resp.NextPage == 0 {
 			break
@@ -95,10 +82,13 @@ func getAllReposForOrg(orga string) orgRepos {
 		Inactive: inactive_repos,
 		Forks:    forks,
 		Count:    len(active_repos) + len(inactive_repos),
-	}
+
+		DefaultBranches: default_branches,
+	}, true
 }
 
-func getAllWorkflowsForRepo(owner string, repo string) map[int64]github.Workflow {
+// getAllWorkflowsForRepo - return the workflows of the repository, and whether all of them could be listed
+func getAllWorkflowsForRepo(owner string, repo string) (map[int64]github.Workflow, bool) {
 	res := make(map[int64]github.Workflow)
 
 	opt := &github.ListOptions{
@@ -106,23 +96,12 @@ func getAllWorkflowsForRepo(owner string, repo string) map[int64]github.Workflow
 		Page:    0,
 	}
 
+	ctx := apiContext("workflows", "ListWorkflows")
 	for {
-		workflows_page, resp, err := client.Actions.ListWorkflows(context.Background(), owner, repo, opt)
-		if rl_err, ok := err.(*github.RateLimitError); ok {
-			log.Printf("ListWorkflows ratelimited. Pausing until %s", rl_err.Rate.Reset.Time.String())
-			time.Sleep(time.Until(rl_err.Rate.Reset.Time))
-			continue
-		} else if err != nil {
-			if resp != nil && resp.StatusCode == http.StatusForbidden {
-				if retryAfterSeconds, e := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 32); e == nil {
-					delaySeconds := retryAfterSeconds + (60 * rand.Int63n(randomDelaySeconds))
-					log.Printf("ListWorkflows Retry-After %d seconds received, sleeping for %d", retryAfterSeconds, delaySeconds)
-					time.Sleep(time.Duration(delaySeconds) * time.Second)
-					continue
-				}
-			}
+		workflows_page, resp, err := client.Actions.ListWorkflows(ctx, owner, repo, opt)
+		if err != nil {
 			log.Printf("ListWorkflows error for %s: %s", repo, err.Error())
-			return res
+			return res, false
 		}
 		for _, w := range workflows_page.Workflows {
 			res[*w.ID] = *w
@@ -133,11 +112,13 @@ func getAllWorkflowsForRepo(owner string, repo string) map[int64]github.Workflow
 		opt.Page = resp.NextPage
 	}
 
-	return res
+	return res, true
 }
 
 func periodicGithubFetcher() {
+	source := workflowsCollector.newSource("workflows")
 	for {
+		series := source.newSnapshot()
 		// Fetch repositories (if dynamic)
 		var repos_to_fetch []string
 		var current_repos_per_org = make(map[string]orgRepos)
@@ -146,22 +127,32 @@ func periodicGithubFetcher() {
 			repos_to_fetch = config.Github.Repositories.Value()
 		} else {
 			for _, orga := range config.Github.Organizations.Value() {
-				var r orgRepos
 				prevRepos, exists := repos_per_org[orga]
+				r := prevRepos
 				if !exists {
 					log.Printf("Cache miss for repo count of org \"%s\", so calling getAllReposForOrg", orga)
-					r = getAllReposForOrg(orga)
+					repos, ok := getAllReposForOrg(orga)
+					if !ok {
+						// not cached, so that the next cycle lists the repositories again
+						continue
+					}
+					r = repos
 				} else {
 					currentCount := countAllReposForOrg(orga)
-					if prevRepos.Count != currentCount {
+					if currentCount < 0 {
+						log.Printf("Keeping the previous repositories of org \"%s\" because its repo count couldn't be fetched", orga)
+					} else if prevRepos.Count != currentCount {
 						log.Printf("countAllReposForOrg of org \"%s\" shows count went from %d to %d, so calling getAllReposForOrg", orga, prevRepos.Count, currentCount)
-						r = getAllReposForOrg(orga)
+						if repos, ok := getAllReposForOrg(orga); ok {
+							r = repos
+						} else {
+							log.Printf("Keeping the previous repositories of org \"%s\" because they couldn't be listed", orga)
+						}
 					} else {
 						// TODO even if the number of repos is unchanged, there could have been changes to the repos, e.g.
 						// if a repo was deleted and another made between metric runs; therefore, we need to look into how
 						// to detect when the response from countAllReposForOrg has the same Etag between requests
 						log.Printf("Skipping getAllReposForOrg because repo count of org \"%s\" was unchanged (%d)", orga, prevRepos.Count)
-						r = repos_per_org[orga]
 					}
 				}
 				current_repos_per_org[orga] = r
@@ -179,7 +170,11 @@ func periodicGithubFetcher() {
 		ww := make(map[string]map[int64]github.Workflow)
 		for _, repo := range repos_to_fetch {
 			r := strings.Split(repo, "/")
-			workflows_for_repo := getAllWorkflowsForRepo(r[0], r[1])
+			workflows_for_repo, ok := getAllWorkflowsForRepo(r[0], r[1])
+			if prev, exists := workflows[repo]; !ok && exists {
+				log.Printf("Keeping the previous workflows of repository %s because they couldn't be listed", repo)
+				workflows_for_repo = prev
+			}
 			if len(workflows_for_repo) == 0 {
 				continue
 			}
@@ -189,6 +184,13 @@ func periodicGithubFetcher() {
 		}
 		repositories = non_empty_repos
 		workflows = ww
+		exportWorkflowsInfo(series, ww)
+		source.publish(series)
+
+		for repo, workflows_for_repo := range ww {
+			workflowLastRuns.seed(repo, workflows_for_repo)
+		}
+		saveWorkflowsState()
 
 		time.Sleep(time.Duration(config.Github.Refresh) * 5 * time.Second)
 	}
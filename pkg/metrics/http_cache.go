@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gregjones/httpcache"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// httpCacheRetention - how long a response which wasn't stored again is kept in the state store, the responses
+	// revalidated by the cache are stored again, so only the responses which aren't requested anymore expire
+	httpCacheRetention = 24 * time.Hour
+)
+
+// persistentCache - httpcache.Cache keeping the responses in memory, and in the state store so that the ETags survive
+// restarts. The responses are written to the store in the background, and read from it on a cache miss in memory.
+type persistentCache struct {
+	memory httpcache.Cache
+	store  *stateStore
+
+	mu      sync.Mutex
+	pending map[string][]byte
+	// lastPrune - only used by flush
+	lastPrune time.Time
+}
+
+func newPersistentCache(memory httpcache.Cache, store *stateStore) *persistentCache {
+	return &persistentCache{memory: memory, store: store, pending: make(map[string][]byte)}
+}
+
+func (c *persistentCache) Get(key string) ([]byte, bool) {
+	if resp, ok := c.memory.Get(key); ok {
+		return resp, true
+	}
+	c.mu.Lock()
+	resp, pending := c.pending[key]
+	c.mu.Unlock()
+	if pending {
+		return resp, resp != nil
+	}
+
+	c.store.db.View(func(tx *bolt.Tx) error {
+		// the first 8 bytes are the time the response was stored
+		if v := tx.Bucket(httpCacheBucket).Get([]byte(key)); len(v) > 8 {
+			resp = append([]byte(nil), v[8:]...)
+		}
+		return nil
+	})
+	if resp == nil {
+		return nil, false
+	}
+	c.memory.Set(key, resp)
+	return resp, true
+}
+
+func (c *persistentCache) Set(key string, resp []byte) {
+	c.memory.Set(key, resp)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[key] = resp
+}
+
+func (c *persistentCache) Delete(key string) {
+	c.memory.Delete(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pending[key] = nil
+}
+
+// flush - write the responses stored or deleted since the last flush, and drop the expired ones every hour
+func (c *persistentCache) flush() {
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[string][]byte)
+	c.mu.Unlock()
+
+	now := time.Now()
+	err := c.store.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(httpCacheBucket)
+		for key, resp := range pending {
+			if resp == nil {
+				if err := b.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			v := make([]byte, 8+len(resp))
+			binary.BigEndian.PutUint64(v, uint64(now.Unix()))
+			copy(v[8:], resp)
+			if err := b.Put([]byte(key), v); err != nil {
+				return err
+			}
+		}
+
+		if now.Sub(c.lastPrune) < time.Hour {
+			return nil
+		}
+		c.lastPrune = now
+		var expired [][]byte
+		b.ForEach(func(k, v []byte) error {
+			if len(v) < 8 || now.Sub(time.Unix(int64(binary.BigEndian.Uint64(v)), 0)) > httpCacheRetention {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		for _, key := range expired {
+			if err := b.Delete(key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("HTTP cache flush error: %s", err)
+	}
+}
+
+// flushPeriodically - flush the cache every refresh cycle
+func (c *persistentCache) flushPeriodically(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		c.flush()
+	}
+}
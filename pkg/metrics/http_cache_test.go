@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/die-net/lrucache"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestPersistentCache(t *testing.T) *persistentCache {
+	store, err := openStateStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.db.Close() })
+	return newPersistentCache(lrucache.New(1<<20, 0), store)
+}
+
+// putStoredResponse - write a response in the store as if it was flushed at the given time
+func putStoredResponse(t *testing.T, c *persistentCache, key string, resp string, stored time.Time) {
+	err := c.store.db.Update(func(tx *bolt.Tx) error {
+		v := make([]byte, 8+len(resp))
+		binary.BigEndian.PutUint64(v, uint64(stored.Unix()))
+		copy(v[8:], resp)
+		return tx.Bucket(httpCacheBucket).Put([]byte(key), v)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPersistentCacheGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		setup     func(c *persistentCache)
+		want      string
+		wantFound bool
+	}{
+		{
+			name:      "set in memory",
+			setup:     func(c *persistentCache) { c.Set("k", []byte("v")) },
+			want:      "v",
+			wantFound: true,
+		},
+		{
+			name: "flushed, then missing in memory",
+			setup: func(c *persistentCache) {
+				c.Set("k", []byte("v"))
+				c.flush()
+				c.memory.Delete("k")
+			},
+			want:      "v",
+			wantFound: true,
+		},
+		{
+			name: "pending set, missing in memory",
+			setup: func(c *persistentCache) {
+				putStoredResponse(t, c, "k", "old", time.Now())
+				c.Set("k", []byte("new"))
+				c.memory.Delete("k")
+			},
+			want:      "new",
+			wantFound: true,
+		},
+		{
+			name: "pending delete of a stored response",
+			setup: func(c *persistentCache) {
+				putStoredResponse(t, c, "k", "v", time.Now())
+				c.Delete("k")
+			},
+			wantFound: false,
+		},
+		{
+			name: "flushed delete",
+			setup: func(c *persistentCache) {
+				c.Set("k", []byte("v"))
+				c.flush()
+				c.Delete("k")
+				c.flush()
+			},
+			wantFound: false,
+		},
+		{
+			name:      "never stored",
+			setup:     func(c *persistentCache) {},
+			wantFound: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestPersistentCache(t)
+			tt.setup(c)
+			resp, found := c.Get("k")
+			if found != tt.wantFound || string(resp) != tt.want {
+				t.Errorf("got %q, %v, want %q, %v", resp, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestPersistentCacheRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, err := openStateStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newPersistentCache(lrucache.New(1<<20, 0), store)
+	c.Set("k", []byte("v"))
+	c.flush()
+	store.db.Close()
+
+	if store, err = openStateStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer store.db.Close()
+	c = newPersistentCache(lrucache.New(1<<20, 0), store)
+	if resp, found := c.Get("k"); !found || string(resp) != "v" {
+		t.Errorf("got %q, %v after a restart", resp, found)
+	}
+}
+
+func TestPersistentCachePrune(t *testing.T) {
+	tests := []struct {
+		name      string
+		stored    time.Duration
+		lastPrune time.Duration
+		wantFound bool
+	}{
+		{"recent response", -time.Hour, 0, true},
+		{"expired response", -httpCacheRetention - time.Hour, 0, false},
+		{"expired response, pruned less than an hour ago", -httpCacheRetention - time.Hour, -time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestPersistentCache(t)
+			putStoredResponse(t, c, "k", "v", time.Now().Add(tt.stored))
+			if tt.lastPrune != 0 {
+				c.lastPrune = time.Now().Add(tt.lastPrune)
+			}
+			c.flush()
+			if _, found := c.Get("k"); found != tt.wantFound {
+				t.Errorf("got found %v, want %v", found, tt.wantFound)
+			}
+		})
+	}
+}
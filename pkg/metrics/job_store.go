@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+// runJobs - jobs of a run attempt, as received from the webhook and reconciled with the API
+type runJobs struct {
+	updated    time.Time
+	reconciled time.Time
+	jobs       map[int64]*workflowJob
+}
+
+// jobStore - in-memory store of the jobs of the run attempts which aren't completed yet, kept up to date by the webhook
+type jobStore struct {
+	mu   sync.Mutex
+	runs map[string]*runJobs
+}
+
+var recentJobs = &jobStore{runs: make(map[string]*runJobs)}
+
+// getJobStatusRank - order of the job statuses, deliveries aren't always received in order
+func getJobStatusRank(status string) int {
+	switch status {
+	case "queued", "waiting":
+		return 0
+	case "in_progress":
+		return 1
+	case "completed":
+		return 2
+	}
+	return 0
+}
+
+func (s *jobStore) getOrCreate(key string) *runJobs {
+	rj, exists := s.runs[key]
+	if !exists {
+		rj = &runJobs{jobs: make(map[int64]*workflowJob)}
+		s.runs[key] = rj
+	}
+	return rj
+}
+
+// merge - insert or update jobs of a run attempt, keeping the most advanced version of each job
+func (rj *runJobs) merge(jobs []*workflowJob) {
+	for _, job := range jobs {
+		prev, exists := rj.jobs[job.GetID()]
+		if exists && getJobStatusRank(prev.GetStatus()) > getJobStatusRank(job.GetStatus()) {
+			continue
+		}
+		rj.jobs[job.GetID()] = job
+	}
+}
+
+// push - insert or update a job received from the webhook
+func (s *jobStore) push(key string, job *workflowJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rj := s.getOrCreate(key)
+	rj.merge([]*workflowJob{job})
+	rj.updated = time.Now()
+}
+
+// reconcile - merge the jobs of a run attempt listed from the API
+func (s *jobStore) reconcile(key string, jobs []*workflowJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rj := s.getOrCreate(key)
+	rj.merge(jobs)
+	rj.reconciled = time.Now()
+	rj.updated = rj.reconciled
+}
+
+// list - jobs of a run attempt, and whether they were reconciled recently enough to be used without calling the API
+func (s *jobStore) list(key string) ([]*workflowJob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rj, exists := s.runs[key]
+	if !exists {
+		return nil, false
+	}
+	jobs := make([]*workflowJob, 0, len(rj.jobs))
+	for _, job := range rj.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].GetID() < jobs[j].GetID()
+	})
+	return jobs, time.Since(rj.reconciled) < config.Webhook.ReconcileInterval
+}
+
+// hasJob - whether a job was received from the webhook or listed from the API
+func (s *jobStore) hasJob(id int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rj := range s.runs {
+		if _, exists := rj.jobs[id]; exists {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jobStore) delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.runs, key)
+}
+
+// forget - drop the run attempts which weren't updated since the given time
+func (s *jobStore) forget(before time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, rj := range s.runs {
+		if rj.updated.Before(before) {
+			delete(s.runs, key)
+		}
+	}
+}
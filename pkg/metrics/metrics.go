@@ -6,7 +6,9 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
 
@@ -21,32 +23,104 @@ import (
 var (
 	client                   *github.Client
 	err                      error
-	workflowRunStatusGauge   *prometheus.GaugeVec
-	workflowRunDurationGauge *prometheus.GaugeVec
+	workflowRunStatusGauge   *prometheus.Desc
+	workflowRunDurationGauge *prometheus.Desc
+	workflowRunQueueGauge    *prometheus.Desc
+	workflowRunAttemptGauge  *prometheus.Desc
+
+	workflowRunDurationHistogram *prometheus.HistogramVec
+
+	workflowJobStepStatusGauge   *prometheus.Desc
+	workflowJobStepDurationGauge *prometheus.Desc
+
+	workflowRunsCollector *snapshotCollector
+	workflowJobsCollector *snapshotCollector
 )
 
 // InitMetrics - register metrics in prometheus lib and start func for monitor
 func InitMetrics() {
-	workflowRunStatusGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "github_workflow_run_status",
-			Help: "Workflow run status of all workflow runs created in the last 12hr",
-		},
+	workflowRunStatusGauge = prometheus.NewDesc(
+		"github_workflow_run_status",
+		"Workflow run status of all workflow runs created in the lookback window",
 		strings.Split(config.WorkflowFields, ","),
+		nil,
 	)
-	workflowRunDurationGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "github_workflow_run_duration_ms",
-			Help: "Workflow run duration (in milliseconds) of all workflow runs created in the last 12hr",
-		},
+	workflowRunDurationGauge = prometheus.NewDesc(
+		"github_workflow_run_duration_ms",
+		"Workflow run duration (in milliseconds) of all workflow runs created in the lookback window, deprecated in favor of github_workflow_run_duration_seconds",
+		strings.Split(config.WorkflowFields, ","),
+		nil,
+	)
+	workflowRunQueueGauge = prometheus.NewDesc(
+		"github_workflow_run_queue_seconds",
+		"Time (in seconds) workflow runs created in the lookback window waited between their creation and their start",
+		strings.Split(config.WorkflowFields, ","),
+		nil,
+	)
+	workflowRunAttemptGauge = prometheus.NewDesc(
+		"github_workflow_run_attempt",
+		"Attempt number of all workflow runs created in the lookback window",
 		strings.Split(config.WorkflowFields, ","),
+		nil,
+	)
+	workflowRunDurationHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "github_workflow_run_duration_seconds",
+			Help:    "Workflow run duration (in seconds) of completed workflow runs, each run attempt being observed once",
+			Buckets: parseBuckets(config.Metrics.WorkflowRunDurationBuckets),
+		},
+		[]string{"repo", "workflow", "branch_class", "conclusion"},
+	)
+	workflowJobStepStatusGauge = prometheus.NewDesc(
+		"github_workflow_job_step_status",
+		"Workflow job step status of all steps belonging to the recent workflow runs",
+		strings.Split(config.StepFields, ","),
+		nil,
 	)
-	prometheus.MustRegister(runnersGauge)
-	prometheus.MustRegister(runnersOrganizationGauge)
-	prometheus.MustRegister(workflowRunStatusGauge)
-	prometheus.MustRegister(workflowRunDurationGauge)
-	prometheus.MustRegister(workflowBillGauge)
-	prometheus.MustRegister(runnersEnterpriseGauge)
+	workflowJobStepDurationGauge = prometheus.NewDesc(
+		"github_workflow_job_step_duration_seconds",
+		"Workflow job step duration (in seconds) of all completed steps belonging to the recent workflow runs",
+		strings.Split(config.StepFields, ","),
+		nil,
+	)
+	workflowRunsCollector = newSnapshotCollector(workflowRunStatusGauge, workflowRunDurationGauge, workflowRunQueueGauge, workflowRunAttemptGauge,
+		workflowFlakinessGauge, workflowFlakyCommitsGauge, workflowLastRunGauge, workflowLastSuccessGauge, workflowFailureStreakGauge)
+	workflowJobsCollector = newSnapshotCollector(workflowJobStatusGauge, workflowJobDurationGauge, workflowJobQueueGauge,
+		workflowJobStepStatusGauge, workflowJobStepDurationGauge, workflowJobFlakinessGauge, workflowJobFlakyCommitsGauge)
+
+	prometheus.MustRegister(collectorsHealth{})
+	prometheus.MustRegister(runnersCollector)
+	prometheus.MustRegister(workflowRunsCollector)
+	prometheus.MustRegister(workflowRunDurationHistogram)
+	prometheus.MustRegister(workflowRunsCounter)
+	prometheus.MustRegister(workflowRunAttemptsCounter)
+	prometheus.MustRegister(workflowRunsRetriedCounter)
+	prometheus.MustRegister(workflowRunsRecoveredCounter)
+	prometheus.MustRegister(workflowJobsCollector)
+	prometheus.MustRegister(workflowRecoveryTimeHistogram)
+	prometheus.MustRegister(workflowsCollector)
+	prometheus.MustRegister(workflowSchedulesCollector)
+	prometheus.MustRegister(workflowScheduleLatenessHistogram)
+	prometheus.MustRegister(actionUsageCollector)
+	prometheus.MustRegister(apiRequestsCounter)
+	prometheus.MustRegister(apiRequestDurationHistogram)
+	prometheus.MustRegister(apiRetriesCounter)
+	prometheus.MustRegister(apiCacheHitsCounter)
+	prometheus.MustRegister(rateLimitsCollector)
+	prometheus.MustRegister(rateLimitSleepCounter)
+	prometheus.MustRegister(webhookDeliveriesCounter)
+	prometheus.MustRegister(workflowUsageCollector)
+	prometheus.MustRegister(billingCollector)
+	prometheus.MustRegister(artifactsCollector)
+	prometheus.MustRegister(actionsCacheCollector)
+
+	if config.DataDir != "" {
+		state, err = openStateStore(config.DataDir)
+		if err != nil {
+			log.Fatalln("Error: State store opening failed. " + err.Error())
+		}
+		loadState()
+	}
 
 	client, err = NewClient()
 	if err != nil {
@@ -62,10 +136,30 @@ func InitMetrics() {
 	}
 
 	go getBillableFromGithub()
+	go getActionsBillingFromGithub()
+	go getArtifactsFromGithub()
+	go getActionsCacheFromGithub()
 	go getRunnersFromGithub()
 	go getRunnersOrganizationFromGithub()
 	go getWorkflowRunsFromGithub()
 	go getRunnersEnterpriseFromGithub()
+	go getWorkflowJobsFromGithub()
+	go getWorkflowSchedulesFromGithub()
+	go getActionUsageFromGithub()
+	go getRateLimitsFromGithub()
+}
+
+// parseBuckets - parse a comma separated list of histogram bucket upper bounds
+func parseBuckets(buckets string) []float64 {
+	var res []float64
+	for _, b := range strings.Split(buckets, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+		if err != nil {
+			log.Fatalln("Error: invalid histogram bucket '" + b + "'. " + err.Error())
+		}
+		res = append(res, v)
+	}
+	return res
 }
 
 // NewClient creates a Github Client
@@ -74,19 +168,33 @@ func NewClient() (*github.Client, error) {
 		httpClient      *http.Client
 		client          *github.Client
 		cachedTransport *httpcache.Transport
+		transport       http.RoundTripper
 	)
 
-	cache := lrucache.New(config.Github.CacheSizeBytes, 0)
+	var cache httpcache.Cache = lrucache.New(config.Github.CacheSizeBytes, 0)
+	if state != nil {
+		// keep the ETags across restarts, so that the first requests can be revalidated
+		persistentHTTPCache = newPersistentCache(cache, state)
+		go persistentHTTPCache.flushPeriodically(time.Duration(config.Github.Refresh) * time.Second)
+		cache = persistentHTTPCache
+	}
 	cachedTransport = httpcache.NewTransport(cache)
+	// instrumented above the cache, so that the requests served by the cache are accounted for too,
+	// and below the retries, so that every attempt is accounted for
+	transport = &retryTransport{
+		next:       &instrumentedTransport{next: cachedTransport},
+		maxRetries: config.Github.MaxRetries,
+		timeout:    config.Github.RequestTimeout,
+	}
 
 	if len(config.Github.Token) > 0 {
 		log.Printf("authenticating with Github Token")
 		ctx := context.Background()
-		ctx = context.WithValue(ctx, "HTTPClient", cachedTransport.Client())
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
 		httpClient = oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.Github.Token}))
 	} else {
 		log.Printf("authenticating with Github App")
-		transport, err := ghinstallation.NewKeyFromFile(cachedTransport, config.Github.AppID, config.Github.AppInstallationID, config.Github.AppPrivateKey)
+		installationTransport, err := ghinstallation.NewKeyFromFile(transport, config.Github.AppID, config.Github.AppInstallationID, config.Github.AppPrivateKey)
 		if err != nil {
 			return nil, fmt.Errorf("authentication failed: %v", err)
 		}
@@ -95,9 +203,9 @@ func NewClient() (*github.Client, error) {
 			if err != nil {
 				return nil, fmt.Errorf("enterprise url incorrect: %v", err)
 			}
-			transport.BaseURL = githubAPIURL
+			installationTransport.BaseURL = githubAPIURL
 		}
-		httpClient = &http.Client{Transport: transport}
+		httpClient = &http.Client{Transport: installationTransport}
 	}
 
 	if config.Github.APIURL != "api.github.com" {
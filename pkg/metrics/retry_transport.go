@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	randomDelaySeconds int64 = 5
+
+	// retryBaseDelay, retryMaxDelay - bounds of the exponential backoff between the retries of the errors
+	retryBaseDelay = time.Second
+	retryMaxDelay  = time.Minute
+	// secondaryRateLimitDelay - delay advised by GitHub when a secondary rate limit response has no Retry-After
+	secondaryRateLimitDelay = time.Minute
+)
+
+// retryTransport - retry the requests to the GitHub API after a transport error, a server error or a rate limit,
+// so that all the collectors behave the same. Rate limits are waited for, honoring Retry-After and x-ratelimit-reset,
+// and the other errors are retried with an exponential backoff. Every request has a retry budget and a timeout.
+type retryTransport struct {
+	next       http.RoundTripper
+	maxRetries int
+	timeout    time.Duration
+}
+
+// cancelOnClose - release the timeout of a request once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	// only the requests without a body can be sent again as is
+	retryable := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		resp, err := t.roundTrip(req)
+		delay, limit, retry := getRetryDelay(resp, err, attempt)
+		if !retry || !retryable || attempt >= t.maxRetries || ctx.Err() != nil {
+			if err == nil && resp.Header.Get("X-RateLimit-Remaining") == "0" {
+				// the rate limit is waited for here, go-github mustn't fail the next requests until the reset
+				resp.Header.Del("X-RateLimit-Reset")
+			}
+			countAPIError(ctx, resp, err)
+			return resp, err
+		}
+
+		var status string
+		if err == nil {
+			status = resp.Status
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		} else {
+			status = err.Error()
+		}
+		log.Printf("%s %s failed (%s), retrying in %s", req.Method, req.URL.Path, status, delay.Round(time.Second))
+
+		if call, ok := ctx.Value(apiCallKey{}).(*apiCall); ok {
+			apiRetriesCounter.WithLabelValues(call.collector, call.endpoint).Inc()
+		}
+		if limit != "" {
+			err = rateLimitSleep(ctx, limit, delay)
+		} else {
+			err = sleepContext(ctx, delay)
+		}
+		if err != nil {
+			countAPIError(ctx, nil, err)
+			return nil, err
+		}
+	}
+}
+
+// roundTrip - send the request once, with its own timeout
+func (t *retryTransport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{resp.Body, cancel}
+	return resp, nil
+}
+
+// getRetryDelay - return whether the request should be sent again, after which delay, and the rate limit
+// (primary or secondary) it hit if any
+func getRetryDelay(resp *http.Response, err error, attempt int) (time.Duration, string, bool) {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return 0, "", false
+		}
+		return getBackoffDelay(attempt), "", true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusTooManyRequests:
+		if retryAfterSeconds, e := strconv.ParseInt(resp.Header.Get("Retry-After"), 10, 32); e == nil {
+			return time.Duration(retryAfterSeconds+(60*rand.Int63n(randomDelaySeconds))) * time.Second, secondaryRateLimit, true
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if reset, e := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); e == nil {
+				return time.Until(time.Unix(reset, 0)) + time.Duration(rand.Int63n(randomDelaySeconds))*time.Second, primaryRateLimit, true
+			}
+			return getBackoffDelay(attempt), primaryRateLimit, true
+		}
+		if isSecondaryRateLimit(resp) {
+			return secondaryRateLimitDelay + time.Duration(60*rand.Int63n(randomDelaySeconds))*time.Second, secondaryRateLimit, true
+		}
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return getBackoffDelay(attempt), "", true
+	}
+	return 0, "", false
+}
+
+// getBackoffDelay - exponential backoff with jitter, between half and the whole of the exponential delay
+func getBackoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)))
+}
+
+// isSecondaryRateLimit - whether a forbidden response is a secondary rate limit, which isn't always sent with Retry-After.
+// The body is read, and replaced for the client to decode it.
+func isSecondaryRateLimit(resp *http.Response) bool {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(body), "secondary rate limit") || strings.Contains(string(body), "abuse detection")
+}
+
+// sleepContext - sleep, unless the context is done before
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
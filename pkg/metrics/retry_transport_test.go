@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetRetryDelay(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		status    int
+		header    map[string]string
+		body      string
+		err       error
+		attempt   int
+		wantRetry bool
+		wantLimit string
+		wantMin   time.Duration
+		wantMax   time.Duration
+	}{
+		{
+			name:      "retry after",
+			status:    http.StatusForbidden,
+			header:    map[string]string{"Retry-After": "30"},
+			wantRetry: true,
+			wantLimit: secondaryRateLimit,
+			wantMin:   30 * time.Second,
+			wantMax:   30*time.Second + 4*time.Minute,
+		},
+		{
+			name:      "primary rate limit with a reset time",
+			status:    http.StatusForbidden,
+			header:    map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": strconv.FormatInt(time.Now().Add(2*time.Minute).Unix(), 10)},
+			wantRetry: true,
+			wantLimit: primaryRateLimit,
+			wantMin:   110 * time.Second,
+			wantMax:   2*time.Minute + 5*time.Second,
+		},
+		{
+			name:      "primary rate limit without a reset time",
+			status:    http.StatusTooManyRequests,
+			header:    map[string]string{"X-RateLimit-Remaining": "0"},
+			attempt:   2,
+			wantRetry: true,
+			wantLimit: primaryRateLimit,
+			wantMin:   2 * time.Second,
+			wantMax:   4 * time.Second,
+		},
+		{
+			name:      "secondary rate limit without retry after",
+			status:    http.StatusForbidden,
+			body:      `{"message":"You have exceeded a secondary rate limit."}`,
+			wantRetry: true,
+			wantLimit: secondaryRateLimit,
+			wantMin:   secondaryRateLimitDelay,
+			wantMax:   secondaryRateLimitDelay + 4*time.Minute,
+		},
+		{
+			name:   "forbidden",
+			status: http.StatusForbidden,
+			body:   `{"message":"Resource not accessible by integration"}`,
+		},
+		{
+			name:      "server error",
+			status:    http.StatusBadGateway,
+			attempt:   1,
+			wantRetry: true,
+			wantMin:   time.Second,
+			wantMax:   2 * time.Second,
+		},
+		{
+			name:      "server error after many attempts",
+			status:    http.StatusServiceUnavailable,
+			attempt:   10,
+			wantRetry: true,
+			wantMin:   retryMaxDelay / 2,
+			wantMax:   retryMaxDelay,
+		},
+		{
+			name:   "not found",
+			status: http.StatusNotFound,
+		},
+		{
+			name:      "transport error",
+			err:       errors.New("connection reset by peer"),
+			wantRetry: true,
+			wantMin:   retryBaseDelay / 2,
+			wantMax:   retryBaseDelay,
+		},
+		{
+			name: "canceled",
+			err:  context.Canceled,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var resp *http.Response
+			if test.err == nil {
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					for k, v := range test.header {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(test.status)
+					io.WriteString(w, test.body)
+				}))
+				defer server.Close()
+				var err error
+				if resp, err = http.Get(server.URL); err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+			}
+
+			delay, limit, retry := getRetryDelay(resp, test.err, test.attempt)
+			if retry != test.wantRetry || limit != test.wantLimit {
+				t.Fatalf("got retry %v limit %q, want retry %v limit %q", retry, limit, test.wantRetry, test.wantLimit)
+			}
+			if retry && (delay < test.wantMin || delay > test.wantMax) {
+				t.Errorf("got delay %s, want between %s and %s", delay, test.wantMin, test.wantMax)
+			}
+			if resp != nil {
+				// the body read to detect a secondary rate limit is still decoded by the client
+				if body, _ := io.ReadAll(resp.Body); string(body) != test.body {
+					t.Errorf("got body %q, want %q", body, test.body)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	reset := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	for _, test := range []struct {
+		name         string
+		method       string
+		statuses     []int
+		header       map[string]string
+		maxRetries   int
+		wantRequests int
+		wantStatus   int
+		wantReset    bool
+	}{
+		{
+			name:         "server errors retried until the retry budget",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			maxRetries:   2,
+			wantRequests: 3,
+			wantStatus:   http.StatusBadGateway,
+		},
+		{
+			name:         "server error retried",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusServiceUnavailable, http.StatusOK},
+			maxRetries:   2,
+			wantRequests: 2,
+			wantStatus:   http.StatusOK,
+		},
+		{
+			name:         "post not retried",
+			method:       http.MethodPost,
+			statuses:     []int{http.StatusBadGateway, http.StatusOK},
+			maxRetries:   2,
+			wantRequests: 1,
+			wantStatus:   http.StatusBadGateway,
+		},
+		{
+			name:         "client error not retried",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusUnprocessableEntity, http.StatusOK},
+			maxRetries:   2,
+			wantRequests: 1,
+			wantStatus:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:         "rate limit reset removed from the final response",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusForbidden},
+			header:       map[string]string{"X-RateLimit-Remaining": "0", "X-RateLimit-Reset": reset},
+			wantRequests: 1,
+			wantStatus:   http.StatusForbidden,
+		},
+		{
+			name:         "rate limit reset kept while requests remain",
+			method:       http.MethodGet,
+			statuses:     []int{http.StatusOK},
+			header:       map[string]string{"X-RateLimit-Remaining": "10", "X-RateLimit-Reset": reset},
+			wantRequests: 1,
+			wantStatus:   http.StatusOK,
+			wantReset:    true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range test.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(test.statuses[requests])
+				requests++
+			}))
+			defer server.Close()
+
+			req, _ := http.NewRequest(test.method, server.URL, strings.NewReader(""))
+			transport := &retryTransport{next: http.DefaultTransport, maxRetries: test.maxRetries, timeout: 10 * time.Second}
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if requests != test.wantRequests || resp.StatusCode != test.wantStatus {
+				t.Errorf("got %d requests and status %d, want %d requests and status %d", requests, resp.StatusCode, test.wantRequests, test.wantStatus)
+			}
+			if hasReset := resp.Header.Get("X-RateLimit-Reset") != ""; hasReset != test.wantReset {
+				t.Errorf("got X-RateLimit-Reset %q", resp.Header.Get("X-RateLimit-Reset"))
+			}
+		})
+	}
+}
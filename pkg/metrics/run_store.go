@@ -0,0 +1,166 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+)
+
+const (
+	// fullSyncInterval - how often the whole window is listed again, to catch the re-runs of completed runs which
+	// completed between two syncs
+	fullSyncInterval = time.Hour
+	// runsPerPage - page size of the workflow runs listings, the window is listed on every sync as long as it fits in a page
+	runsPerPage = 100
+)
+
+// rerunStatuses - statuses of the pending runs, listed on every incremental sync to catch the re-runs of completed runs
+var rerunStatuses = []string{"queued", "in_progress"}
+
+// repoRuns - workflow runs of a repository, merged across incremental fetches
+type repoRuns struct {
+	mu sync.Mutex
+	// watermark - runs created after this time were all fetched
+	watermark time.Time
+	lastSync  time.Time
+	lastFull  time.Time
+	runs      map[int64]*github.WorkflowRun
+
+	// pending - runs received from the webhook, merged on the next call, so that deliveries never wait for a sync
+	pendingMu sync.Mutex
+	pending   []*github.WorkflowRun
+	// stale - the runs should be synced on the next call, even if the webhook keeps them up to date
+	stale atomic.Bool
+}
+
+// runStore - in-memory store of the workflow runs created in the lookback window
+type runStore struct {
+	mu    sync.Mutex
+	repos map[string]*repoRuns
+}
+
+var recentRuns = &runStore{repos: make(map[string]*repoRuns)}
+
+func (s *runStore) get(repo string) *repoRuns {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rr, exists := s.repos[repo]
+	if !exists {
+		rr = &repoRuns{runs: make(map[int64]*github.WorkflowRun)}
+		s.repos[repo] = rr
+	}
+	return rr
+}
+
+// lookup - return the runs of a repository already synced, nil for the repositories which aren't monitored
+func (s *runStore) lookup(repo string) *repoRuns {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.repos[repo]
+}
+
+// push - queue a run received from the webhook
+func (rr *repoRuns) push(run *github.WorkflowRun) {
+	rr.pendingMu.Lock()
+	defer rr.pendingMu.Unlock()
+	rr.pending = append(rr.pending, run)
+}
+
+// mergePending - merge the runs received from the webhook since the last call
+func (rr *repoRuns) mergePending() {
+	rr.pendingMu.Lock()
+	pending := rr.pending
+	rr.pending = nil
+	rr.pendingMu.Unlock()
+	rr.merge(pending)
+}
+
+// merge - insert or update runs, keeping the most recently updated version of each run
+func (rr *repoRuns) merge(runs []*github.WorkflowRun) {
+	for _, run := range runs {
+		prev, exists := rr.runs[run.GetID()]
+		if exists && prev.GetUpdatedAt().After(run.GetUpdatedAt().Time) {
+			continue
+		}
+		rr.runs[run.GetID()] = run
+	}
+}
+
+// list - runs created after windowStart, most recent first
+func (rr *repoRuns) list(windowStart time.Time) []*github.WorkflowRun {
+	runs := make([]*github.WorkflowRun, 0, len(rr.runs))
+	for id, run := range rr.runs {
+		if run.GetCreatedAt().Before(windowStart) {
+			delete(rr.runs, id)
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].GetCreatedAt().After(runs[j].GetCreatedAt().Time)
+	})
+	return runs
+}
+
+// sync - fetch the whole window on the first call, and as long as it fits in a page, then only the runs created since
+// the watermark and the pending ones. When the webhook keeps the runs up to date, it only reconciles them.
+func (rr *repoRuns) sync(owner string, repo string) {
+	now := time.Now()
+	interval := time.Duration(config.Github.Refresh) * time.Second / 2
+	if webhookEnabled() && !rr.stale.Load() && interval < config.Webhook.ReconcileInterval {
+		interval = config.Webhook.ReconcileInterval
+	}
+	if now.Sub(rr.lastSync) < interval {
+		return
+	}
+
+	// the bounds are rounded down to the hour, so that the requests don't change for an hour and the HTTP cache can
+	// revalidate them
+	windowStart := now.Add(-config.Metrics.WorkflowRunsWindow).Truncate(time.Hour)
+	if rr.watermark.IsZero() || now.Sub(rr.lastFull) > fullSyncInterval || len(rr.runs) < runsPerPage {
+		runs, ok := listWorkflowRunsCreatedSince(owner, repo, windowStart, "")
+		rr.merge(runs)
+		if ok {
+			rr.watermark = now
+			rr.lastFull = now
+			rr.lastSync = now
+			rr.stale.Store(false)
+		}
+		return
+	}
+
+	listed := make(map[int64]bool)
+	// overlap the watermark a bit, runs aren't always listed as soon as they are created
+	runs, ok := listWorkflowRunsCreatedSince(owner, repo, rr.watermark.Add(-time.Minute).Truncate(time.Hour), "")
+	// re-runs keep the creation time of the run, so the re-runs of completed runs are listed while they are pending
+	for _, status := range rerunStatuses {
+		pending, complete := listWorkflowRunsCreatedSince(owner, repo, windowStart, status)
+		runs = append(runs, pending...)
+		ok = ok && complete
+	}
+	for _, run := range runs {
+		listed[run.GetID()] = true
+	}
+	rr.merge(runs)
+	if !ok {
+		return
+	}
+
+	// the pending runs which weren't listed anymore completed, or are waiting
+	for id, run := range rr.runs {
+		if run.GetStatus() == "completed" || listed[id] {
+			continue
+		}
+		if updated := getWorkflowRun("workflow_runs", owner, repo, id); updated != nil {
+			rr.merge([]*github.WorkflowRun{updated})
+		}
+	}
+	rr.watermark = now
+	rr.lastSync = now
+	rr.stale.Store(false)
+}
@@ -0,0 +1,157 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+// newTestClient - point the client at a test server
+func newTestClient(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	previous := client
+	client = github.NewClient(nil)
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	t.Cleanup(func() {
+		server.Close()
+		client = previous
+	})
+}
+
+// newTestRunsServer - serve the given runs of o/r, listed by creation time and status, return the requests received
+func newTestRunsServer(t *testing.T, runs map[int64]*github.WorkflowRun) *[]string {
+	var requests []string
+	newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.RequestURI())
+		w.Header().Set("Content-Type", "application/json")
+
+		if id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/repos/o/r/actions/runs/"), 10, 64); err == nil {
+			json.NewEncoder(w).Encode(runs[id])
+			return
+		}
+		since, _ := time.Parse(time.RFC3339, strings.TrimPrefix(r.URL.Query().Get("created"), ">="))
+		status := r.URL.Query().Get("status")
+		var listed []*github.WorkflowRun
+		for _, run := range runs {
+			if !run.GetCreatedAt().Before(since) && (status == "" || run.GetStatus() == status) {
+				listed = append(listed, run)
+			}
+		}
+		json.NewEncoder(w).Encode(&github.WorkflowRuns{TotalCount: github.Int(len(listed)), WorkflowRuns: listed})
+	})
+	return &requests
+}
+
+func TestRepoRunsSync(t *testing.T) {
+	config.Github.Refresh = 30
+	config.Metrics.WorkflowRunsWindow = 8 * time.Hour
+	now := time.Now()
+	run := func(id int64, age time.Duration, status string) *github.WorkflowRun {
+		return &github.WorkflowRun{ID: github.Int64(id), Status: github.String(status), CreatedAt: &github.Timestamp{Time: now.Add(-age)}, UpdatedAt: &github.Timestamp{Time: now.Add(-age)}}
+	}
+	// manyRuns - enough completed runs for the window not to fit in a page
+	manyRuns := func(runs ...*github.WorkflowRun) map[int64]*github.WorkflowRun {
+		res := make(map[int64]*github.WorkflowRun)
+		for id := int64(1000); id < 1000+runsPerPage; id++ {
+			res[id] = run(id, 2*time.Hour, "completed")
+		}
+		for _, r := range runs {
+			res[r.GetID()] = r
+		}
+		return res
+	}
+
+	tests := []struct {
+		name string
+		runs map[int64]*github.WorkflowRun
+		// update - change the runs between the first and the second sync
+		update func(runs map[int64]*github.WorkflowRun)
+		// wantRequests - number of requests of the second sync
+		wantRequests int
+		wantStatus   map[int64]string
+	}{
+		{
+			name:         "window in a page listed again",
+			runs:         map[int64]*github.WorkflowRun{1: run(1, time.Hour, "completed")},
+			update:       func(runs map[int64]*github.WorkflowRun) { runs[1] = run(1, time.Hour, "queued") },
+			wantRequests: 1,
+			wantStatus:   map[int64]string{1: "queued"},
+		},
+		{
+			name:         "new run",
+			runs:         manyRuns(),
+			update:       func(runs map[int64]*github.WorkflowRun) { runs[1] = run(1, 0, "queued") },
+			wantRequests: 1 + len(rerunStatuses),
+			wantStatus:   map[int64]string{1: "queued"},
+		},
+		{
+			name:         "re-run of a completed run",
+			runs:         manyRuns(run(1, 3*time.Hour, "completed")),
+			update:       func(runs map[int64]*github.WorkflowRun) { runs[1] = run(1, 3*time.Hour, "in_progress") },
+			wantRequests: 1 + len(rerunStatuses),
+			wantStatus:   map[int64]string{1: "in_progress"},
+		},
+		{
+			name:         "pending run still listed",
+			runs:         manyRuns(run(1, 3*time.Hour, "queued")),
+			wantRequests: 1 + len(rerunStatuses),
+			wantStatus:   map[int64]string{1: "queued"},
+		},
+		{
+			name:         "pending run which completed",
+			runs:         manyRuns(run(1, 3*time.Hour, "in_progress")),
+			update:       func(runs map[int64]*github.WorkflowRun) { runs[1] = run(1, 3*time.Hour, "completed") },
+			wantRequests: 1 + len(rerunStatuses) + 1,
+			wantStatus:   map[int64]string{1: "completed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := newTestRunsServer(t, tt.runs)
+			rr := &repoRuns{runs: make(map[int64]*github.WorkflowRun)}
+			rr.sync("o", "r")
+			if tt.update != nil {
+				tt.update(tt.runs)
+			}
+			*requests = nil
+			rr.lastSync = time.Time{}
+			rr.sync("o", "r")
+
+			if len(*requests) != tt.wantRequests {
+				t.Errorf("got requests %v, want %d", *requests, tt.wantRequests)
+			}
+			for id, status := range tt.wantStatus {
+				if got := rr.runs[id].GetStatus(); got != status {
+					t.Errorf("got run %d %s, want %s", id, got, status)
+				}
+			}
+			// the listings don't change during the hour, so that the HTTP cache can revalidate them
+			listings := func() string {
+				var res []string
+				for _, request := range *requests {
+					if strings.Contains(request, "created=") {
+						res = append(res, request)
+					}
+				}
+				return strings.Join(res, " ")
+			}
+			second := listings()
+			*requests = nil
+			rr.lastSync = time.Time{}
+			rr.sync("o", "r")
+			if third := listings(); third != second && time.Now().Truncate(time.Hour).Equal(now.Truncate(time.Hour)) {
+				t.Errorf("got listings %s, then %s", second, third)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+)
+
+// runTracker - remember which workflow run attempts were already accounted for across polling cycles,
+// so that cumulative metrics observe every completed run exactly once
+type runTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{seen: make(map[string]time.Time)}
+}
+
+func getRunKey(run *github.WorkflowRun) string {
+	return getRunAttemptKey(run.GetID(), run.GetRunAttempt())
+}
+
+func getRunAttemptKey(runId int64, attempt int) string {
+	return strconv.FormatInt(runId, 10) + "/" + strconv.Itoa(attempt)
+}
+
+// markCompleted - return true the first time a completed run attempt is passed
+func (t *runTracker) markCompleted(run *github.WorkflowRun) bool {
+	if run.GetStatus() != "completed" {
+		return false
+	}
+	key := getRunKey(run)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.seen[key]; exists {
+		return false
+	}
+	t.seen[key] = run.GetCreatedAt().Time
+	return true
+}
+
+// forget - drop the run attempts created before the given time, they can't show up in the window anymore
+func (t *runTracker) forget(before time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key, created := range t.seen {
+		if created.Before(before) {
+			delete(t.seen, key)
+		}
+	}
+}
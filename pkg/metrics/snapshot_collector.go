@@ -0,0 +1,236 @@
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	collectorUpDesc = prometheus.NewDesc(
+		"github_exporter_collector_up",
+		"Whether the last snapshot of a collector was built without any GitHub API error (1) or not (0), 0 until its first snapshot",
+		[]string{"collector"},
+		nil,
+	)
+	collectorSnapshotAgeDesc = prometheus.NewDesc(
+		"github_exporter_collector_snapshot_age_seconds",
+		"Time (in seconds) since a collector published its last snapshot",
+		[]string{"collector"},
+		nil,
+	)
+	collectorCycleDurationDesc = prometheus.NewDesc(
+		"github_exporter_collector_cycle_duration_seconds",
+		"Time (in seconds) a collector took to build its last snapshot",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+const (
+	// failedScopeRetention - how long the series of a scope are kept from the previous snapshots while its API calls fail
+	failedScopeRetention = time.Hour
+)
+
+// snapshotCollector - prometheus.Collector of the gauges of a subsystem. Every cycle, the fetchers of the subsystem
+// build a snapshot of their gauges, and publish it atomically once complete, so that a scrape never sees half updated data.
+// The series a fetcher didn't set again (deleted runners, runs which left the window, ...) disappear with the previous snapshot.
+type snapshotCollector struct {
+	descs []*prometheus.Desc
+
+	mu      sync.Mutex
+	sources []*snapshotSource
+}
+
+// snapshotSource - fetcher publishing snapshots to a collector. Its name is the collector label of the API requests it sends,
+// the API errors of the requests sent on behalf of the other collectors it depends on are accounted for too.
+type snapshotSource struct {
+	name          string
+	apiCollectors []string
+	last          atomic.Pointer[snapshot]
+}
+
+type snapshot struct {
+	source    *snapshotSource
+	metrics   map[seriesKey]prometheus.Metric
+	started   time.Time
+	published time.Time
+	apiErrors uint64
+	up        bool
+
+	// scopes - scope of every series, see beginScope
+	scopes      map[seriesKey]string
+	scope       string
+	scopeErrors uint64
+	// failedSince - when the API calls of the scopes which failed during the cycle started failing
+	failedSince map[string]time.Time
+}
+
+type seriesKey struct {
+	desc   *prometheus.Desc
+	labels string
+}
+
+// snapshotSources - every source, for the health of the collectors
+var snapshotSources = struct {
+	sync.Mutex
+	sources []*snapshotSource
+}{}
+
+func newSnapshotCollector(descs ...*prometheus.Desc) *snapshotCollector {
+	return &snapshotCollector{descs: descs}
+}
+
+// newSource - register a fetcher of the collector, it is reported down until its first snapshot
+func (c *snapshotCollector) newSource(name string, apiCollectors ...string) *snapshotSource {
+	s := &snapshotSource{name: name, apiCollectors: append([]string{name}, apiCollectors...)}
+
+	c.mu.Lock()
+	c.sources = append(c.sources, s)
+	c.mu.Unlock()
+
+	snapshotSources.Lock()
+	snapshotSources.sources = append(snapshotSources.sources, s)
+	snapshotSources.Unlock()
+	return s
+}
+
+func (s *snapshotSource) getAPIErrors() uint64 {
+	var count uint64
+	for _, collector := range s.apiCollectors {
+		count += getAPIErrorCount(collector)
+	}
+	return count
+}
+
+// newSnapshot - start the snapshot of a cycle
+func (s *snapshotSource) newSnapshot() *snapshot {
+	apiErrors := s.getAPIErrors()
+	return &snapshot{
+		source:      s,
+		metrics:     make(map[seriesKey]prometheus.Metric),
+		started:     time.Now(),
+		apiErrors:   apiErrors,
+		scopes:      make(map[seriesKey]string),
+		scopeErrors: apiErrors,
+		failedSince: make(map[string]time.Time),
+	}
+}
+
+// beginScope - start the scope (usually a repository or an organization) of the series set next. The API errors since
+// the previous call are accounted for to the previous scope, the series set before the first call belong to the "" scope.
+func (s *snapshot) beginScope(scope string) {
+	if apiErrors := s.source.getAPIErrors(); apiErrors != s.scopeErrors {
+		s.failedSince[s.scope] = s.started
+		s.scopeErrors = apiErrors
+	}
+	s.scope = scope
+}
+
+// failed - whether the API calls of a scope failed during the cycle, only accounted for once another scope began
+func (s *snapshot) failed(scope string) bool {
+	_, failed := s.failedSince[scope]
+	return failed
+}
+
+// fail - report the current scope failed, e.g. when its series depend on a scope which failed
+func (s *snapshot) fail() {
+	s.failedSince[s.scope] = s.started
+}
+
+// publish - replace the previous snapshot, the snapshot mustn't be modified afterwards. When an API call failed during
+// the cycle, the series of its scope may be missing, so the series of the scope are kept from the previous snapshot
+// instead, for up to failedScopeRetention, and the snapshot is reported down. The other scopes are published as usual.
+func (s *snapshotSource) publish(snap *snapshot) {
+	snap.beginScope("")
+	snap.published = time.Now()
+	snap.up = s.getAPIErrors() == snap.apiErrors
+
+	prev := s.last.Load()
+	if prev == nil {
+		s.last.Store(snap)
+		return
+	}
+	kept := make(map[string]bool)
+	for scope := range snap.failedSince {
+		if since, exists := prev.failedSince[scope]; exists {
+			snap.failedSince[scope] = since
+		}
+		kept[scope] = snap.published.Sub(snap.failedSince[scope]) <= failedScopeRetention
+	}
+	for key, scope := range snap.scopes {
+		if kept[scope] {
+			delete(snap.metrics, key)
+			delete(snap.scopes, key)
+		}
+	}
+	for key, scope := range prev.scopes {
+		if _, exists := snap.metrics[key]; kept[scope] && !exists {
+			snap.metrics[key] = prev.metrics[key]
+			snap.scopes[key] = scope
+		}
+	}
+	s.last.Store(snap)
+}
+
+// set - set the value of a gauge series in the snapshot, in the current scope, the last value set wins
+func (s *snapshot) set(desc *prometheus.Desc, value float64, lvs ...string) {
+	key := seriesKey{desc, strings.Join(lvs, "\xff")}
+	s.metrics[key] = prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, lvs...)
+	s.scopes[key] = s.scope
+}
+
+func (c *snapshotCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.descs {
+		ch <- desc
+	}
+}
+
+func (c *snapshotCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	sources := c.sources
+	c.mu.Unlock()
+
+	for _, s := range sources {
+		snap := s.last.Load()
+		if snap == nil {
+			continue
+		}
+		for _, m := range snap.metrics {
+			ch <- m
+		}
+	}
+}
+
+// collectorsHealth - prometheus.Collector of the health of every snapshot source
+type collectorsHealth struct{}
+
+func (collectorsHealth) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collectorUpDesc
+	ch <- collectorSnapshotAgeDesc
+	ch <- collectorCycleDurationDesc
+}
+
+func (collectorsHealth) Collect(ch chan<- prometheus.Metric) {
+	snapshotSources.Lock()
+	sources := snapshotSources.sources
+	snapshotSources.Unlock()
+
+	for _, s := range sources {
+		snap := s.last.Load()
+		if snap == nil {
+			ch <- prometheus.MustNewConstMetric(collectorUpDesc, prometheus.GaugeValue, 0, s.name)
+			continue
+		}
+		up := 0.0
+		if snap.up {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collectorUpDesc, prometheus.GaugeValue, up, s.name)
+		ch <- prometheus.MustNewConstMetric(collectorSnapshotAgeDesc, prometheus.GaugeValue, time.Since(snap.published).Seconds(), s.name)
+		ch <- prometheus.MustNewConstMetric(collectorCycleDurationDesc, prometheus.GaugeValue, snap.published.Sub(snap.started).Seconds(), s.name)
+	}
+}
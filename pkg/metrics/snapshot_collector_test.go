@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var testSnapshotDesc = prometheus.NewDesc("test_snapshot_gauge", "Test gauge", []string{"repo", "series"}, nil)
+
+// getSnapshotSeries - return the label values of the series served by a source, sorted
+func getSnapshotSeries(s *snapshotSource) []string {
+	var res []string
+	for _, m := range s.last.Load().metrics {
+		var d dto.Metric
+		m.Write(&d)
+		var lvs []string
+		for _, l := range d.Label {
+			lvs = append(lvs, l.GetValue())
+		}
+		res = append(res, strings.Join(lvs, "/"))
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestSnapshotScopes(t *testing.T) {
+	// cycle - the ids of the series set for each repository, and the repositories whose API calls fail
+	type cycle struct {
+		series  map[string][]string
+		failing map[string]bool
+		// age - how long ago the cycle started
+		age time.Duration
+	}
+
+	tests := []struct {
+		name   string
+		cycles []cycle
+		want   []string
+		wantUp bool
+	}{
+		{
+			name: "series which weren't set again disappear",
+			cycles: []cycle{
+				{series: map[string][]string{"a": {"1", "2"}, "b": {"1"}}},
+				{series: map[string][]string{"a": {"2"}}},
+			},
+			want:   []string{"a/2"},
+			wantUp: true,
+		},
+		{
+			name: "the series of a failed repository are kept, the others are published",
+			cycles: []cycle{
+				{series: map[string][]string{"a": {"1", "2"}, "b": {"1", "2"}}},
+				{series: map[string][]string{"a": {"1"}, "b": {"3"}}, failing: map[string]bool{"a": true}},
+			},
+			want: []string{"a/1", "a/2", "b/3"},
+		},
+		{
+			name: "kept across several failed cycles",
+			cycles: []cycle{
+				{series: map[string][]string{"a": {"1"}, "b": {"1"}}},
+				{series: map[string][]string{}, failing: map[string]bool{"a": true}},
+				{series: map[string][]string{"b": {"2"}}, failing: map[string]bool{"a": true}},
+			},
+			want: []string{"a/1", "b/2"},
+		},
+		{
+			name: "dropped once the repository succeeds again",
+			cycles: []cycle{
+				{series: map[string][]string{"a": {"1"}}},
+				{series: map[string][]string{}, failing: map[string]bool{"a": true}},
+				{series: map[string][]string{"a": {"2"}}},
+			},
+			want:   []string{"a/2"},
+			wantUp: true,
+		},
+		{
+			name: "partial series published once the repository failed for too long",
+			cycles: []cycle{
+				{series: map[string][]string{"a": {"1", "2"}}, age: 3 * time.Hour},
+				{series: map[string][]string{"a": {"1"}}, failing: map[string]bool{"a": true}, age: 2 * time.Hour},
+				{series: map[string][]string{"a": {"1"}}, failing: map[string]bool{"a": true}},
+			},
+			want: []string{"a/1"},
+		},
+		{
+			name: "partial series published without a previous snapshot",
+			cycles: []cycle{
+				{series: map[string][]string{"a": {"1"}, "b": {"1"}}, failing: map[string]bool{"a": true}},
+			},
+			want: []string{"a/1", "b/1"},
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newSnapshotCollector(testSnapshotDesc).newSource("test_snapshot_" + string(rune('a'+i)))
+			for _, c := range tt.cycles {
+				series := source.newSnapshot()
+				series.started = time.Now().Add(-c.age)
+				var repos []string
+				for repo := range c.series {
+					repos = append(repos, repo)
+				}
+				for repo := range c.failing {
+					if _, exists := c.series[repo]; !exists {
+						repos = append(repos, repo)
+					}
+				}
+				for _, repo := range repos {
+					series.beginScope(repo)
+					if c.failing[repo] {
+						apiErrors.Lock()
+						apiErrors.counts[source.name]++
+						apiErrors.Unlock()
+					}
+					for _, id := range c.series[repo] {
+						series.set(testSnapshotDesc, 1, repo, id)
+					}
+				}
+				source.publish(series)
+			}
+
+			if got := getSnapshotSeries(source); strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("got series %v, want %v", got, tt.want)
+			}
+			if up := source.last.Load().up; up != tt.wantUp {
+				t.Errorf("got up %v, want %v", up, tt.wantUp)
+			}
+		})
+	}
+}
@@ -0,0 +1,466 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	stateBucket     = []byte("state")
+	httpCacheBucket = []byte("http_cache")
+
+	// state - store of the state of the collectors, nil when nothing is persisted
+	state *stateStore
+
+	// persistedCounters - counters restored on startup, the run attempts they account for are persisted along with them
+	persistedCounters = map[string]*prometheus.CounterVec{
+		"github_workflow_runs_total":           workflowRunsCounter,
+		"github_workflow_run_attempts_total":   workflowRunAttemptsCounter,
+		"github_workflow_runs_retried_total":   workflowRunsRetriedCounter,
+		"github_workflow_runs_recovered_total": workflowRunsRecoveredCounter,
+	}
+
+	// stateMu - held by the workflow runs collector while it updates the state it saves, so that it can be saved on shutdown
+	stateMu sync.Mutex
+	// stagedIncrements - increments of the persisted counters since the last save. They are only applied once saved, so
+	// that a restart never restores a counter lower than a value already scraped. Only used with stateMu held.
+	stagedIncrements []stagedIncrement
+
+	// persistentHTTPCache - the HTTP cache backed by the state store, flushed on shutdown
+	persistentHTTPCache *persistentCache
+)
+
+type stagedIncrement struct {
+	vec     *prometheus.CounterVec
+	counter prometheus.Counter
+}
+
+// stateStore - file-backed store of the state of the collectors, so that a restart neither resets the counters nor
+// needs a full resync. Every collector saves its state at the end of its cycle, and all of it is loaded on startup.
+type stateStore struct {
+	db *bolt.DB
+}
+
+func openStateStore(dir string) (*stateStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filepath.Join(dir, "state.db"), 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filepath.Join(dir, "state.db"), err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{stateBucket, httpCacheBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &stateStore{db: db}, nil
+}
+
+// save - save the given entries, JSON encoded, in a single transaction, return false if they couldn't be saved
+func (s *stateStore) save(entries map[string]interface{}) bool {
+	if s == nil {
+		return false
+	}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(stateBucket)
+		for name, v := range entries {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			if err := b.Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("State save error: %s", err)
+		return false
+	}
+	return true
+}
+
+// load - decode a saved entry into v, return false if it was never saved
+func (s *stateStore) load(name string, v interface{}) bool {
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(stateBucket).Get([]byte(name))
+		if data == nil {
+			return nil
+		}
+		found = true
+		return json.Unmarshal(data, v)
+	})
+	if err != nil {
+		log.Printf("State load error for %s: %s", name, err)
+		return false
+	}
+	return found
+}
+
+type savedRepoRuns struct {
+	Watermark time.Time
+	LastFull  time.Time
+	Runs      []*github.WorkflowRun
+}
+
+type savedWorkflowBranch struct {
+	Repo         string
+	WorkflowID   int64
+	Branch       string
+	LastRun      time.Time
+	LastSuccess  time.Time
+	Count        int
+	FirstFailure time.Time
+}
+
+type savedLastRuns struct {
+	Runs   []savedWorkflowBranch
+	Seeded []string
+}
+
+type savedAttemptConclusion struct {
+	Conclusion string
+	Created    time.Time
+}
+
+type savedRunAttempts struct {
+	Conclusions map[string]savedAttemptConclusion
+	Retried     map[int64]time.Time
+}
+
+type savedFlakinessOutcome struct {
+	Repo, Workflow, Job, SHA string
+	Failed                   bool
+	Created                  time.Time
+}
+
+type savedCounter struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// saveWorkflowsState - save the repositories and the workflows, only called by the workflows fetcher. An empty set of
+// workflows isn't saved, so that a cycle which couldn't list anything doesn't replace the saved ones.
+func saveWorkflowsState() {
+	if len(workflows) == 0 {
+		return
+	}
+	state.save(map[string]interface{}{
+		"repositories":  repositories,
+		"repos_per_org": repos_per_org,
+		"workflows":     workflows,
+	})
+}
+
+// incPersistedCounter - increment a persisted counter, only once the state accounting for the increment is saved
+// when the state is persisted. Only called with stateMu held.
+func incPersistedCounter(vec *prometheus.CounterVec, lvs ...string) {
+	counter := vec.WithLabelValues(lvs...)
+	if state == nil {
+		counter.Inc()
+		return
+	}
+	stagedIncrements = append(stagedIncrements, stagedIncrement{vec, counter})
+}
+
+// saveWorkflowRunsState - save the state of the workflow runs collector, along with the staged counter increments,
+// and apply them once saved. Only called with stateMu held.
+func saveWorkflowRunsState() {
+	if state == nil {
+		return
+	}
+
+	runs := make(map[string]savedRepoRuns)
+	recentRuns.mu.Lock()
+	repos := make(map[string]*repoRuns, len(recentRuns.repos))
+	for repo, rr := range recentRuns.repos {
+		repos[repo] = rr
+	}
+	recentRuns.mu.Unlock()
+	for repo, rr := range repos {
+		rr.mu.Lock()
+		saved := savedRepoRuns{Watermark: rr.watermark, LastFull: rr.lastFull}
+		for _, run := range rr.runs {
+			saved.Runs = append(saved.Runs, trimWorkflowRun(run))
+		}
+		rr.mu.Unlock()
+		runs[repo] = saved
+	}
+
+	completedRuns.mu.Lock()
+	completed := make(map[string]time.Time, len(completedRuns.seen))
+	for key, created := range completedRuns.seen {
+		completed[key] = created
+	}
+	completedRuns.mu.Unlock()
+
+	var lastRuns savedLastRuns
+	workflowLastRuns.mu.Lock()
+	for key, last := range workflowLastRuns.runs {
+		lastRuns.Runs = append(lastRuns.Runs, savedWorkflowBranch{Repo: key.repo, WorkflowID: key.workflowId, Branch: key.branch, LastRun: last.lastRun, LastSuccess: last.lastSuccess})
+	}
+	for seedKey := range workflowLastRuns.seeded {
+		lastRuns.Seeded = append(lastRuns.Seeded, seedKey)
+	}
+	workflowLastRuns.mu.Unlock()
+
+	var streaks []savedWorkflowBranch
+	for key, streak := range failureStreaks {
+		streaks = append(streaks, savedWorkflowBranch{Repo: key.repo, WorkflowID: key.workflowId, Branch: key.branch, LastRun: streak.lastRun, Count: streak.count, FirstFailure: streak.firstFailure})
+	}
+
+	attempts := savedRunAttempts{Conclusions: make(map[string]savedAttemptConclusion), Retried: retriedRuns}
+	for key, attempt := range attemptConclusions {
+		attempts.Conclusions[key] = savedAttemptConclusion{attempt.conclusion, attempt.created}
+	}
+
+	flakiness.mu.Lock()
+	outcomes := make(map[string]savedFlakinessOutcome, len(flakiness.outcomes))
+	for id, o := range flakiness.outcomes {
+		outcomes[id] = savedFlakinessOutcome{o.repo, o.workflow, o.job, o.sha, o.failed, o.created}
+	}
+	flakiness.mu.Unlock()
+
+	counters := make(map[string][]savedCounter)
+	for name, vec := range persistedCounters {
+		counters[name] = dumpCounter(vec, stagedIncrements)
+	}
+
+	saved := state.save(map[string]interface{}{
+		"workflow_runs":   runs,
+		"completed_runs":  completed,
+		"last_runs":       lastRuns,
+		"failure_streaks": streaks,
+		"run_attempts":    attempts,
+		"flakiness":       outcomes,
+		"counters":        counters,
+	})
+	if !saved {
+		return
+	}
+	for _, inc := range stagedIncrements {
+		inc.counter.Inc()
+	}
+	stagedIncrements = nil
+}
+
+// saveWorkflowJobsState - save the jobs of the completed run attempts, only called by the workflow jobs collector goroutine
+func saveWorkflowJobsState() {
+	if state == nil {
+		return
+	}
+	jobs := make(map[string][]*workflowJob, len(completedRunJobs))
+	for key, jobsOfRun := range completedRunJobs {
+		for _, job := range jobsOfRun {
+			jobs[key] = append(jobs[key], trimWorkflowJob(job))
+		}
+	}
+	state.save(map[string]interface{}{
+		"completed_run_jobs": jobs,
+	})
+}
+
+// trimWorkflowRun - keep the fields of a run the collectors use, without the nested objects of the API responses
+// (repositories, commit, actor, ...) which would make up most of the saved state
+func trimWorkflowRun(run *github.WorkflowRun) *github.WorkflowRun {
+	return &github.WorkflowRun{
+		ID:           run.ID,
+		NodeID:       run.NodeID,
+		HeadBranch:   run.HeadBranch,
+		HeadSHA:      run.HeadSHA,
+		RunNumber:    run.RunNumber,
+		RunAttempt:   run.RunAttempt,
+		Event:        run.Event,
+		Status:       run.Status,
+		Conclusion:   run.Conclusion,
+		WorkflowID:   run.WorkflowID,
+		CreatedAt:    run.CreatedAt,
+		UpdatedAt:    run.UpdatedAt,
+		RunStartedAt: run.RunStartedAt,
+	}
+}
+
+// trimWorkflowJob - keep the fields of a job the collectors use, without the URLs of the API responses
+func trimWorkflowJob(job *workflowJob) *workflowJob {
+	return &workflowJob{
+		WorkflowJob: github.WorkflowJob{
+			ID:              job.ID,
+			RunID:           job.RunID,
+			HeadSHA:         job.HeadSHA,
+			Name:            job.Name,
+			Status:          job.Status,
+			Conclusion:      job.Conclusion,
+			StartedAt:       job.StartedAt,
+			CompletedAt:     job.CompletedAt,
+			Steps:           job.Steps,
+			Labels:          job.Labels,
+			RunnerName:      job.RunnerName,
+			RunnerGroupName: job.RunnerGroupName,
+		},
+		CreatedAt:  job.CreatedAt,
+		RunAttempt: job.RunAttempt,
+	}
+}
+
+// getMetricLabels - return the labels of a series, and their key
+func getMetricLabels(m prometheus.Metric) (map[string]string, string, *dto.Metric) {
+	var d dto.Metric
+	if err := m.Write(&d); err != nil {
+		return nil, "", nil
+	}
+	labels := make(map[string]string, len(d.Label))
+	var key []string
+	for _, l := range d.Label {
+		labels[l.GetName()] = l.GetValue()
+		key = append(key, l.GetName()+"="+l.GetValue())
+	}
+	return labels, strings.Join(key, "\xff"), &d
+}
+
+// dumpCounter - return the value of every series of a counter, including its staged increments
+func dumpCounter(vec *prometheus.CounterVec, staged []stagedIncrement) []savedCounter {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		vec.Collect(ch)
+		close(ch)
+	}()
+
+	var res []savedCounter
+	index := make(map[string]int)
+	for m := range ch {
+		labels, key, d := getMetricLabels(m)
+		if d == nil {
+			continue
+		}
+		index[key] = len(res)
+		res = append(res, savedCounter{labels, d.GetCounter().GetValue()})
+	}
+
+	for _, inc := range staged {
+		if inc.vec != vec {
+			continue
+		}
+		// the series of the staged increments were created when staged, so they were collected above
+		if _, key, d := getMetricLabels(inc.counter); d != nil {
+			if i, exists := index[key]; exists {
+				res[i].Value++
+			}
+		}
+	}
+	return res
+}
+
+// SaveState - save the state of the workflow runs collector and flush the HTTP cache, on shutdown. The state store is
+// closed and the workflow runs collector stopped, the exporter must exit afterwards.
+func SaveState() {
+	if state == nil {
+		return
+	}
+	stateMu.Lock()
+	saveWorkflowRunsState()
+	if persistentHTTPCache != nil {
+		persistentHTTPCache.flush()
+	}
+	state.db.Close()
+}
+
+// loadState - restore the state saved by the collectors, before they start
+func loadState() {
+	var repos []string
+	var reposPerOrg map[string]orgRepos
+	var ww map[string]map[int64]github.Workflow
+	if state.load("repositories", &repos) && state.load("repos_per_org", &reposPerOrg) && state.load("workflows", &ww) && len(ww) > 0 {
+		repositories = repos
+		repos_per_org = reposPerOrg
+		workflows = ww
+		log.Printf("Loaded %d repositories from the state store", len(repos))
+	}
+
+	var runs map[string]savedRepoRuns
+	state.load("workflow_runs", &runs)
+	for repo, saved := range runs {
+		rr := recentRuns.get(repo)
+		rr.watermark = saved.Watermark
+		rr.lastFull = saved.LastFull
+		rr.merge(saved.Runs)
+	}
+
+	state.load("completed_runs", &completedRuns.seen)
+	if completedRuns.seen == nil {
+		completedRuns.seen = make(map[string]time.Time)
+	}
+
+	var lastRuns savedLastRuns
+	state.load("last_runs", &lastRuns)
+	for _, saved := range lastRuns.Runs {
+		workflowLastRuns.runs[workflowBranchKey{saved.Repo, saved.WorkflowID, saved.Branch}] = &workflowLastRun{lastRun: saved.LastRun, lastSuccess: saved.LastSuccess}
+	}
+	for _, seedKey := range lastRuns.Seeded {
+		workflowLastRuns.seeded[seedKey] = true
+	}
+
+	var streaks []savedWorkflowBranch
+	state.load("failure_streaks", &streaks)
+	for _, saved := range streaks {
+		failureStreaks[workflowBranchKey{saved.Repo, saved.WorkflowID, saved.Branch}] = &failureStreak{count: saved.Count, firstFailure: saved.FirstFailure, lastRun: saved.LastRun}
+	}
+
+	var attempts savedRunAttempts
+	state.load("run_attempts", &attempts)
+	for key, saved := range attempts.Conclusions {
+		attemptConclusions[key] = attemptConclusion{saved.Conclusion, saved.Created}
+	}
+	for runId, created := range attempts.Retried {
+		retriedRuns[runId] = created
+	}
+
+	var outcomes map[string]savedFlakinessOutcome
+	state.load("flakiness", &outcomes)
+	for id, o := range outcomes {
+		flakiness.outcomes[id] = flakinessOutcome{o.Repo, o.Workflow, o.Job, o.SHA, o.Failed, o.Created}
+	}
+
+	var counters map[string][]savedCounter
+	state.load("counters", &counters)
+	for name, series := range counters {
+		vec, exists := persistedCounters[name]
+		if !exists {
+			continue
+		}
+		for _, c := range series {
+			counter, err := vec.GetMetricWith(c.Labels)
+			if err != nil {
+				log.Printf("State load error for counter %s: %s", name, err)
+				continue
+			}
+			counter.Add(c.Value)
+		}
+	}
+
+	var jobs map[string][]*workflowJob
+	state.load("completed_run_jobs", &jobs)
+	for key, jobsOfRun := range jobs {
+		completedRunJobs[key] = jobsOfRun
+	}
+}
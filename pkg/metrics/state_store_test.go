@@ -0,0 +1,321 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// resetStateGlobals - drop the state of the collectors, as a restart would
+func resetStateGlobals() {
+	repositories, repos_per_org, workflows = nil, nil, nil
+	recentRuns = &runStore{repos: make(map[string]*repoRuns)}
+	completedRuns = newRunTracker()
+	workflowLastRuns = &workflowLastRunsState{runs: make(map[workflowBranchKey]*workflowLastRun), seeded: make(map[string]bool), defaultBranches: make(map[string]string)}
+	failureStreaks = make(map[workflowBranchKey]*failureStreak)
+	attemptConclusions = make(map[string]attemptConclusion)
+	retriedRuns = make(map[int64]time.Time)
+	flakiness = &flakinessTracker{outcomes: make(map[string]flakinessOutcome)}
+	completedRunJobs = make(map[string][]*workflowJob)
+	stagedIncrements = nil
+	for _, vec := range persistedCounters {
+		vec.Reset()
+	}
+}
+
+// openTestStateStore - open a state store in a temporary directory, and return a function simulating a restart
+func openTestStateStore(t *testing.T) func() {
+	dir := t.TempDir()
+	var err error
+	if state, err = openStateStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		state.db.Close()
+		state = nil
+		resetStateGlobals()
+	})
+	return func() {
+		state.db.Close()
+		resetStateGlobals()
+		if state, err = openStateStore(dir); err != nil {
+			t.Fatal(err)
+		}
+		loadState()
+	}
+}
+
+func saveAllState() {
+	saveWorkflowsState()
+	saveWorkflowRunsState()
+	saveWorkflowJobsState()
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	ts := &github.Timestamp{Time: created}
+	run := &github.WorkflowRun{ID: github.Int64(7), RunAttempt: github.Int(2), WorkflowID: github.Int64(1), Status: github.String("completed"), CreatedAt: ts, UpdatedAt: ts}
+	key := workflowBranchKey{"o/r", 1, "main"}
+
+	tests := []struct {
+		name  string
+		set   func()
+		check func(t *testing.T)
+	}{
+		{
+			name: "workflows",
+			set: func() {
+				repositories = []string{"o/r"}
+				repos_per_org = map[string]orgRepos{"o": {Active: []string{"o/r"}, Count: 1}}
+				workflows = map[string]map[int64]github.Workflow{"o/r": {1: {ID: github.Int64(1), Name: github.String("ci")}}}
+			},
+			check: func(t *testing.T) {
+				if len(repositories) != 1 || repos_per_org["o"].Count != 1 || *workflows["o/r"][1].Name != "ci" {
+					t.Errorf("got repositories %v, repos_per_org %v, workflows %v", repositories, repos_per_org, workflows)
+				}
+			},
+		},
+		{
+			name: "workflow runs",
+			set: func() {
+				rr := recentRuns.get("o/r")
+				rr.merge([]*github.WorkflowRun{run})
+				rr.watermark = created
+				rr.lastFull = created
+			},
+			check: func(t *testing.T) {
+				rr := recentRuns.lookup("o/r")
+				if rr == nil || rr.runs[7] == nil || !rr.watermark.Equal(created) || !rr.lastFull.Equal(created) {
+					t.Errorf("got %+v", rr)
+				}
+			},
+		},
+		{
+			name: "completed runs",
+			set:  func() { completedRuns.markCompleted(run) },
+			check: func(t *testing.T) {
+				if completedRuns.markCompleted(run) {
+					t.Error("completed run attempt accounted for again")
+				}
+			},
+		},
+		{
+			name: "last runs",
+			set: func() {
+				workflowLastRuns.update("o/r", run)
+				workflowLastRuns.seeded["o/r/1/main"] = true
+			},
+			check: func(t *testing.T) {
+				if last := workflowLastRuns.runs[workflowBranchKey{"o/r", 1, ""}]; last == nil || !last.lastRun.Equal(created) || !workflowLastRuns.seeded["o/r/1/main"] {
+					t.Errorf("got %+v, seeded %v", last, workflowLastRuns.seeded)
+				}
+			},
+		},
+		{
+			name: "failure streaks",
+			set:  func() { failureStreaks[key] = &failureStreak{count: 3, firstFailure: created, lastRun: created} },
+			check: func(t *testing.T) {
+				if streak := failureStreaks[key]; streak == nil || streak.count != 3 || !streak.firstFailure.Equal(created) {
+					t.Errorf("got %+v", streak)
+				}
+			},
+		},
+		{
+			name: "run attempts",
+			set: func() {
+				attemptConclusions["7/1"] = attemptConclusion{"failure", created}
+				retriedRuns[7] = created
+			},
+			check: func(t *testing.T) {
+				if attemptConclusions["7/1"].conclusion != "failure" || !retriedRuns[7].Equal(created) {
+					t.Errorf("got %v, %v", attemptConclusions, retriedRuns)
+				}
+			},
+		},
+		{
+			name: "flakiness",
+			set:  func() { flakiness.record("7/1", "o/r", "ci", "", "abc", "failure", created) },
+			check: func(t *testing.T) {
+				if o := flakiness.outcomes["7/1"]; o.sha != "abc" || !o.failed {
+					t.Errorf("got %+v", o)
+				}
+			},
+		},
+		{
+			name: "completed run jobs",
+			set:  func() { completedRunJobs["7/2"] = []*workflowJob{{CreatedAt: ts, RunAttempt: github.Int(2)}} },
+			check: func(t *testing.T) {
+				if jobs := completedRunJobs["7/2"]; len(jobs) != 1 || jobs[0].CreatedAt == nil || *jobs[0].RunAttempt != 2 {
+					t.Errorf("got %v", jobs)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restart := openTestStateStore(t)
+			// the workflows state is only saved with some workflows
+			workflows = map[string]map[int64]github.Workflow{"o/r": {1: {ID: github.Int64(1), Name: github.String("ci")}}}
+			tt.set()
+			saveAllState()
+			restart()
+			tt.check(t)
+		})
+	}
+}
+
+func TestCounterRestore(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []string
+		value  float64
+	}{
+		{"github_workflow_runs_total", []string{"o/r", "ci", "success", "push"}, 3},
+		{"github_workflow_run_attempts_total", []string{"o/r", "ci", "default"}, 5},
+		{"github_workflow_runs_retried_total", []string{"o/r", "ci", "pull_request"}, 2},
+		{"github_workflow_runs_recovered_total", []string{"o/r", "ci", "other"}, 1},
+	}
+
+	restart := openTestStateStore(t)
+	for _, tt := range tests {
+		persistedCounters[tt.name].WithLabelValues(tt.labels...).Add(tt.value)
+	}
+	saveWorkflowRunsState()
+	restart()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if v := testutil.ToFloat64(persistedCounters[tt.name].WithLabelValues(tt.labels...)); v != tt.value {
+				t.Errorf("got %v, want %v", v, tt.value)
+			}
+		})
+	}
+}
+
+func TestEmptyWorkflowsState(t *testing.T) {
+	tests := []struct {
+		name          string
+		save          func()
+		wantWorkflows int
+	}{
+		{
+			name: "empty workflows aren't saved over the previous ones",
+			save: func() {
+				repositories = []string{"o/r"}
+				workflows = map[string]map[int64]github.Workflow{"o/r": {1: {ID: github.Int64(1)}}}
+				saveWorkflowsState()
+				repositories = nil
+				workflows = map[string]map[int64]github.Workflow{}
+				saveWorkflowsState()
+			},
+			wantWorkflows: 1,
+		},
+		{
+			name: "empty workflows aren't restored",
+			save: func() {
+				state.save(map[string]interface{}{
+					"repositories":  []string{},
+					"repos_per_org": map[string]orgRepos{},
+					"workflows":     map[string]map[int64]github.Workflow{},
+				})
+			},
+			wantWorkflows: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restart := openTestStateStore(t)
+			tt.save()
+			restart()
+			if len(workflows) != tt.wantWorkflows {
+				t.Errorf("got workflows %v, want %d repositories", workflows, tt.wantWorkflows)
+			}
+			if tt.wantWorkflows == 0 && workflows != nil {
+				t.Error("workflows restored, the exporter wouldn't wait for the first workflows cycle")
+			}
+		})
+	}
+}
+
+func TestStagedCounterIncrements(t *testing.T) {
+	labels := []string{"o/r", "ci", "success", "push"}
+
+	tests := []struct {
+		name string
+		// save - save the state once the counter was incremented, return the value scrapes could see before the restart
+		save func() float64
+	}{
+		{
+			name: "applied once saved at the end of the cycle",
+			save: func() float64 {
+				saveWorkflowRunsState()
+				return testutil.ToFloat64(workflowRunsCounter.WithLabelValues(labels...))
+			},
+		},
+		{
+			name: "saved on shutdown before the end of the cycle",
+			save: func() float64 {
+				scraped := testutil.ToFloat64(workflowRunsCounter.WithLabelValues(labels...))
+				SaveState()
+				stateMu.Unlock()
+				return scraped
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restart := openTestStateStore(t)
+			workflowRunsCounter.WithLabelValues(labels...).Add(2)
+			saveWorkflowRunsState()
+
+			incPersistedCounter(workflowRunsCounter, labels...)
+			if v := testutil.ToFloat64(workflowRunsCounter.WithLabelValues(labels...)); v != 2 {
+				t.Errorf("got %v before the save, the increment mustn't be scraped yet", v)
+			}
+			scraped := tt.save()
+			restart()
+			if v := testutil.ToFloat64(workflowRunsCounter.WithLabelValues(labels...)); v != 3 || v < scraped {
+				t.Errorf("got %v after a restart, want 3, scraped %v", v, scraped)
+			}
+		})
+	}
+}
+
+func TestStateTrimmedRunsAndJobs(t *testing.T) {
+	ts := &github.Timestamp{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)}
+	restart := openTestStateStore(t)
+
+	run := &github.WorkflowRun{
+		ID: github.Int64(7), RunAttempt: github.Int(1), WorkflowID: github.Int64(1), HeadSHA: github.String("abc"),
+		Status: github.String("completed"), Conclusion: github.String("success"), CreatedAt: ts, UpdatedAt: ts,
+		Repository: &github.Repository{FullName: github.String("o/r")},
+		HeadCommit: &github.HeadCommit{Message: github.String("commit")},
+		Actor:      &github.User{Login: github.String("octocat")},
+	}
+	recentRuns.get("o/r").merge([]*github.WorkflowRun{run})
+	job := &workflowJob{CreatedAt: ts, RunAttempt: github.Int(1)}
+	job.ID, job.Name, job.HTMLURL = github.Int64(9), github.String("build"), github.String("https://github.com/o/r/runs/9")
+	completedRunJobs["7/1"] = []*workflowJob{job}
+	saveAllState()
+	restart()
+
+	restored := recentRuns.lookup("o/r").runs[7]
+	if restored == nil || restored.GetHeadSHA() != "abc" || restored.GetConclusion() != "success" || !restored.GetCreatedAt().Time.Equal(ts.Time) {
+		t.Fatalf("got run %+v", restored)
+	}
+	if restored.Repository != nil || restored.HeadCommit != nil || restored.Actor != nil {
+		t.Error("nested objects of the run saved")
+	}
+	jobs := completedRunJobs["7/1"]
+	if len(jobs) != 1 || jobs[0].GetName() != "build" || jobs[0].CreatedAt == nil {
+		t.Fatalf("got jobs %v", jobs)
+	}
+	if jobs[0].HTMLURL != nil {
+		t.Error("URLs of the job saved")
+	}
+}
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	webhookDeliveriesCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "github_exporter_webhook_deliveries_total",
+			Help: "Number of webhook deliveries received, by event and outcome",
+		},
+		[]string{"event", "status"},
+	)
+
+	// ErrInvalidSignature - the webhook delivery isn't signed with the configured secret
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// workflowJobEvent - github.WorkflowJobEvent along with the job fields go-github v45 doesn't decode
+type workflowJobEvent struct {
+	Action      *string            `json:"action,omitempty"`
+	WorkflowJob *workflowJob       `json:"workflow_job,omitempty"`
+	Repo        *github.Repository `json:"repository,omitempty"`
+}
+
+func webhookEnabled() bool {
+	return config.Webhook.Secret != ""
+}
+
+// HandleWebhook - verify a webhook delivery against the configured secret, and feed the workflow runs and jobs it
+// carries to the stores the collectors read from. The deliveries of the repositories which aren't monitored are ignored.
+func HandleWebhook(event string, signature string, payload []byte) error {
+	if !strings.HasPrefix(signature, "sha256=") || github.ValidateSignature(signature, payload, []byte(config.Webhook.Secret)) != nil {
+		// the event header isn't trusted before the signature is checked
+		webhookDeliveriesCounter.WithLabelValues("unknown", "invalid_signature").Inc()
+		return ErrInvalidSignature
+	}
+
+	status, err := handleWebhookEvent(event, payload)
+	if err != nil {
+		log.Printf("Webhook %s delivery error: %s", event, err)
+		status = "invalid_payload"
+	}
+	webhookDeliveriesCounter.WithLabelValues(getWebhookEventLabel(event), status).Inc()
+	return err
+}
+
+// getWebhookEventLabel - keep the cardinality of the event label bounded
+func getWebhookEventLabel(event string) string {
+	switch event {
+	case "ping", "workflow_run", "workflow_job", "check_run":
+		return event
+	}
+	return "other"
+}
+
+func handleWebhookEvent(event string, payload []byte) (string, error) {
+	switch event {
+	case "ping":
+		return "processed", nil
+
+	case "workflow_run":
+		e := new(github.WorkflowRunEvent)
+		if err := json.Unmarshal(payload, e); err != nil {
+			return "", err
+		}
+		rr := recentRuns.lookup(e.GetRepo().GetFullName())
+		if rr == nil || e.WorkflowRun == nil {
+			return "ignored", nil
+		}
+		rr.push(e.WorkflowRun)
+		return "processed", nil
+
+	case "workflow_job":
+		e := new(workflowJobEvent)
+		if err := json.Unmarshal(payload, e); err != nil {
+			return "", err
+		}
+		// the jobs are only pruned by the workflow jobs collector
+		rr := recentRuns.lookup(e.Repo.GetFullName())
+		if rr == nil || e.WorkflowJob == nil || !workflowJobsEnabled() {
+			return "ignored", nil
+		}
+		attempt := 1
+		if e.WorkflowJob.RunAttempt != nil {
+			attempt = *e.WorkflowJob.RunAttempt
+		}
+		recentJobs.push(getRunAttemptKey(e.WorkflowJob.GetRunID(), attempt), e.WorkflowJob)
+		return "processed", nil
+
+	case "check_run":
+		e := new(github.CheckRunEvent)
+		if err := json.Unmarshal(payload, e); err != nil {
+			return "", err
+		}
+		rr := recentRuns.lookup(e.GetRepo().GetFullName())
+		if rr == nil || e.GetCheckRun().GetApp().GetSlug() != "github-actions" || e.GetAction() != "completed" || !workflowJobsEnabled() {
+			return "ignored", nil
+		}
+		// the check runs of GitHub Actions share their ID with the jobs, so a completed check run of an unknown job
+		// means the workflow_job deliveries are missing, the runs are synced from the API on the next cycle instead
+		if !recentJobs.hasJob(e.GetCheckRun().GetID()) {
+			rr.stale.Store(true)
+		}
+		return "processed", nil
+	}
+	return "ignored", nil
+}
@@ -0,0 +1,210 @@
+package metrics
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+const testWebhookSecret = "secret"
+
+func signWebhookPayload(prefix string, h func() hash.Hash, secret string, payload string) string {
+	mac := hmac.New(h, []byte(secret))
+	mac.Write([]byte(payload))
+	return prefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandleWebhook(t *testing.T) {
+	runPayload := func(repo string) string {
+		return `{"action": "completed", "workflow_run": {"id": 7, "status": "completed"}, "repository": {"full_name": "` + repo + `"}}`
+	}
+	jobPayload := func(repo string) string {
+		return `{"action": "queued", "workflow_job": {"id": 9, "run_id": 7, "run_attempt": 2, "status": "queued"}, "repository": {"full_name": "` + repo + `"}}`
+	}
+	checkRunPayload := `{"action": "completed", "check_run": {"id": 9, "app": {"slug": "github-actions"}}, "repository": {"full_name": "o/r"}}`
+
+	tests := []struct {
+		name      string
+		event     string
+		signature string
+		payload   string
+		jobs      bool
+		wantErr   bool
+		// wantLabels - event and status of the delivery counter
+		wantLabels []string
+		check      func(t *testing.T)
+	}{
+		{
+			name:       "missing signature",
+			event:      "ping",
+			payload:    `{}`,
+			wantErr:    true,
+			wantLabels: []string{"unknown", "invalid_signature"},
+		},
+		{
+			name:       "signature with another secret",
+			event:      "ping",
+			signature:  signWebhookPayload("sha256=", sha256.New, "other", `{}`),
+			payload:    `{}`,
+			wantErr:    true,
+			wantLabels: []string{"unknown", "invalid_signature"},
+		},
+		{
+			name:       "SHA-1 signature",
+			event:      "ping",
+			signature:  signWebhookPayload("sha1=", sha1.New, testWebhookSecret, `{}`),
+			payload:    `{}`,
+			wantErr:    true,
+			wantLabels: []string{"unknown", "invalid_signature"},
+		},
+		{
+			name:       "SHA-256 digest without prefix",
+			event:      "ping",
+			signature:  signWebhookPayload("", sha256.New, testWebhookSecret, `{}`),
+			payload:    `{}`,
+			wantErr:    true,
+			wantLabels: []string{"unknown", "invalid_signature"},
+		},
+		{
+			name:       "ping",
+			event:      "ping",
+			payload:    `{"zen": "Keep it logically awesome."}`,
+			wantLabels: []string{"ping", "processed"},
+		},
+		{
+			name:       "workflow run of a monitored repository",
+			event:      "workflow_run",
+			payload:    runPayload("o/r"),
+			wantLabels: []string{"workflow_run", "processed"},
+			check: func(t *testing.T) {
+				if rr := recentRuns.lookup("o/r"); len(rr.pending) != 1 || rr.pending[0].GetID() != 7 {
+					t.Errorf("got pending runs %v", rr.pending)
+				}
+			},
+		},
+		{
+			name:       "workflow run of a repository which isn't monitored",
+			event:      "workflow_run",
+			payload:    runPayload("o/other"),
+			wantLabels: []string{"workflow_run", "ignored"},
+			check: func(t *testing.T) {
+				if recentRuns.lookup("o/other") != nil || len(recentRuns.lookup("o/r").pending) != 0 {
+					t.Error("run of a repository which isn't monitored stored")
+				}
+			},
+		},
+		{
+			name:       "workflow job",
+			event:      "workflow_job",
+			payload:    jobPayload("o/r"),
+			jobs:       true,
+			wantLabels: []string{"workflow_job", "processed"},
+			check: func(t *testing.T) {
+				if jobs, _ := recentJobs.list("7/2"); len(jobs) != 1 || jobs[0].GetID() != 9 {
+					t.Errorf("got jobs %v", jobs)
+				}
+			},
+		},
+		{
+			name:       "workflow job of a repository which isn't monitored",
+			event:      "workflow_job",
+			payload:    jobPayload("o/other"),
+			jobs:       true,
+			wantLabels: []string{"workflow_job", "ignored"},
+			check: func(t *testing.T) {
+				if len(recentJobs.runs) != 0 {
+					t.Errorf("got jobs %v", recentJobs.runs)
+				}
+			},
+		},
+		{
+			name:       "workflow job while the jobs aren't collected",
+			event:      "workflow_job",
+			payload:    jobPayload("o/r"),
+			wantLabels: []string{"workflow_job", "ignored"},
+			check: func(t *testing.T) {
+				if len(recentJobs.runs) != 0 {
+					t.Errorf("got jobs %v", recentJobs.runs)
+				}
+			},
+		},
+		{
+			name:       "check run of a job which wasn't delivered",
+			event:      "check_run",
+			payload:    checkRunPayload,
+			jobs:       true,
+			wantLabels: []string{"check_run", "processed"},
+			check: func(t *testing.T) {
+				if !recentRuns.lookup("o/r").stale.Load() {
+					t.Error("repository not reported stale")
+				}
+			},
+		},
+		{
+			name:       "check run while the jobs aren't collected",
+			event:      "check_run",
+			payload:    checkRunPayload,
+			wantLabels: []string{"check_run", "ignored"},
+			check: func(t *testing.T) {
+				if recentRuns.lookup("o/r").stale.Load() {
+					t.Error("repository reported stale")
+				}
+			},
+		},
+		{
+			name:       "other event",
+			event:      "issues",
+			payload:    `{}`,
+			wantLabels: []string{"other", "ignored"},
+		},
+		{
+			name:       "invalid payload",
+			event:      "workflow_run",
+			payload:    `{"workflow_run": [}`,
+			wantErr:    true,
+			wantLabels: []string{"workflow_run", "invalid_payload"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.Webhook.Secret = testWebhookSecret
+			config.Metrics.FetchWorkflowJobs = tt.jobs
+			recentRuns = &runStore{repos: make(map[string]*repoRuns)}
+			recentRuns.get("o/r")
+			recentJobs = &jobStore{runs: make(map[string]*runJobs)}
+			defer func() {
+				config.Webhook.Secret = ""
+				config.Metrics.FetchWorkflowJobs = false
+				recentRuns = &runStore{repos: make(map[string]*repoRuns)}
+				recentJobs = &jobStore{runs: make(map[string]*runJobs)}
+			}()
+
+			invalidSignature := tt.wantLabels[1] == "invalid_signature"
+			signature := tt.signature
+			if signature == "" && !invalidSignature {
+				signature = signWebhookPayload("sha256=", sha256.New, testWebhookSecret, tt.payload)
+			}
+			counter := webhookDeliveriesCounter.WithLabelValues(tt.wantLabels...)
+			before := testutil.ToFloat64(counter)
+
+			err := HandleWebhook(tt.event, signature, []byte(tt.payload))
+			if (err != nil) != tt.wantErr || (err == ErrInvalidSignature) != invalidSignature {
+				t.Errorf("got error %v", err)
+			}
+			if delta := testutil.ToFloat64(counter) - before; delta != 1 {
+				t.Errorf("delivery counted %v times with labels %v", delta, tt.wantLabels)
+			}
+			if tt.check != nil {
+				tt.check(t)
+			}
+		})
+	}
+}
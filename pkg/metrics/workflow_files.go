@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v45/github"
+	"gopkg.in/yaml.v3"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/config"
+)
+
+// workflowFile - parts of a workflow file the exporter is interested in
+type workflowFile struct {
+	sha       string
+	fetched   time.Time
+	schedules []string
+	uses      []string
+}
+
+// workflowFileSyntax - subset of the workflow syntax, "on" can be a string, a list or a map
+type workflowFileSyntax struct {
+	On   yaml.Node `yaml:"on"`
+	Jobs map[string]struct {
+		// Uses - reusable workflow called by the job
+		Uses  string `yaml:"uses"`
+		Steps []struct {
+			Uses string `yaml:"uses"`
+		} `yaml:"steps"`
+	} `yaml:"jobs"`
+}
+
+// workflowFilesCache - parsed workflow files by <repo>/<path>, only parsed again when their sha changes
+var workflowFilesCache = struct {
+	sync.Mutex
+	files map[string]*workflowFile
+}{files: make(map[string]*workflowFile)}
+
+func getWorkflowFileContent(owner string, repo string, path string) *github.RepositoryContent {
+	content, _, _, err := client.Repositories.GetContents(apiContext("workflow_files", "GetContents"), owner, repo, path, nil)
+	if err != nil {
+		log.Printf("GetContents error for repo %s/%s and path %s: %s", owner, repo, path, err.Error())
+		return nil
+	}
+	return content
+}
+
+// getScheduleCrons - return the cron expressions of the "on.schedule" trigger
+func getScheduleCrons(on *yaml.Node) []string {
+	if on.Kind != yaml.MappingNode {
+		// "on: push" or "on: [push, schedule]" can't hold cron expressions
+		return nil
+	}
+
+	var triggers struct {
+		Schedule []struct {
+			Cron string `yaml:"cron"`
+		} `yaml:"schedule"`
+	}
+	if err := on.Decode(&triggers); err != nil {
+		log.Printf("Couldn't decode the schedule trigger at line %d: %s", on.Line, err.Error())
+		return nil
+	}
+
+	var crons []string
+	for _, s := range triggers.Schedule {
+		if s.Cron != "" {
+			crons = append(crons, s.Cron)
+		}
+	}
+	return crons
+}
+
+func parseWorkflowFile(content []byte) (*workflowFile, error) {
+	var syntax workflowFileSyntax
+	if err := yaml.Unmarshal(content, &syntax); err != nil {
+		return nil, err
+	}
+
+	var uses []string
+	for _, job := range syntax.Jobs {
+		if job.Uses != "" {
+			uses = append(uses, job.Uses)
+		}
+		for _, step := range job.Steps {
+			if step.Uses != "" {
+				uses = append(uses, step.Uses)
+			}
+		}
+	}
+
+	return &workflowFile{
+		schedules: getScheduleCrons(&syntax.On),
+		uses:      uses,
+	}, nil
+}
+
+// getWorkflowFile - fetch and parse the workflow file at path on the default branch of the repository.
+// The file is shared by several collectors, so it isn't fetched again when it was fetched during the last half cycle.
+func getWorkflowFile(owner string, repo string, path string) *workflowFile {
+	key := owner + "/" + repo + "/" + path
+	workflowFilesCache.Lock()
+	cached := workflowFilesCache.files[key]
+	fresh := cached != nil && time.Since(cached.fetched) < time.Duration(config.Github.Refresh)*5*time.Second/2
+	workflowFilesCache.Unlock()
+	if fresh {
+		return cached
+	}
+
+	content := getWorkflowFileContent(owner, repo, path)
+	if content == nil {
+		return cached
+	}
+	if cached != nil && cached.sha == content.GetSHA() {
+		workflowFilesCache.Lock()
+		cached.fetched = time.Now()
+		workflowFilesCache.Unlock()
+		return cached
+	}
+
+	decoded, err := content.GetContent()
+	if err != nil {
+		log.Printf("Couldn't decode workflow file %s: %s", key, err.Error())
+		return cached
+	}
+	file, err := parseWorkflowFile([]byte(decoded))
+	if err != nil {
+		log.Printf("Couldn't parse workflow file %s: %s", key, err.Error())
+		return cached
+	}
+	file.sha = content.GetSHA()
+	file.fetched = time.Now()
+
+	workflowFilesCache.Lock()
+	workflowFilesCache.files[key] = file
+	workflowFilesCache.Unlock()
+	return file
+}
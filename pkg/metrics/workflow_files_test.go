@@ -0,0 +1,124 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWorkflowFile(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		schedules []string
+		uses      []string
+		wantErr   bool
+	}{
+		{
+			name:    "on as a string",
+			content: "on: push\njobs:\n  build:\n    steps:\n      - uses: actions/checkout@v4\n",
+			uses:    []string{"actions/checkout@v4"},
+		},
+		{
+			name:    "on as a list",
+			content: "on: [push, schedule]\njobs: {}\n",
+		},
+		{
+			name: "single schedule entry",
+			content: `on:
+  schedule:
+    - cron: "0 9 * * *"
+`,
+			schedules: []string{"0 9 * * *"},
+		},
+		{
+			name: "several schedule entries along with other triggers",
+			content: `on:
+  push:
+    branches: [main]
+  schedule:
+    - cron: "0 9 * * 1-5"
+    - cron: "30 */6 * * *"
+  workflow_dispatch:
+`,
+			schedules: []string{"0 9 * * 1-5", "30 */6 * * *"},
+		},
+		{
+			name: "schedule entries without cron are ignored",
+			content: `on:
+  schedule:
+    - cron: ""
+    - {}
+    - cron: "0 0 * * 0"
+`,
+			schedules: []string{"0 0 * * 0"},
+		},
+		{
+			name: "invalid cron expressions are kept, they are skipped when evaluated",
+			content: `on:
+  schedule:
+    - cron: "not a cron"
+`,
+			schedules: []string{"not a cron"},
+		},
+		{
+			name: "schedule isn't a list",
+			content: `on:
+  schedule: "0 9 * * *"
+`,
+		},
+		{
+			name: "steps and reusable workflows",
+			content: `on: pull_request
+jobs:
+  call:
+    uses: octo/workflows/.github/workflows/ci.yml@main
+  build:
+    steps:
+      - run: make
+      - uses: actions/setup-go@v5
+`,
+			uses: []string{"actions/setup-go@v5", "octo/workflows/.github/workflows/ci.yml@main"},
+		},
+		{
+			name:    "invalid YAML",
+			content: "on: [push\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := parseWorkflowFile([]byte(tt.content))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(file.schedules, tt.schedules) {
+				t.Errorf("got schedules %q, want %q", file.schedules, tt.schedules)
+			}
+			// the jobs are a map, their order isn't kept
+			if !sameStrings(file.uses, tt.uses) {
+				t.Errorf("got uses %q, want %q", file.uses, tt.uses)
+			}
+		})
+	}
+}
+
+// sameStrings - whether a and b hold the same strings, whatever their order
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	count := make(map[string]int)
+	for _, s := range a {
+		count[s]++
+	}
+	for _, s := range b {
+		if count[s]--; count[s] < 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -2,7 +2,10 @@ package server
 
 import (
 	"log"
+	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	"github.com/fasthttp/router"
 	"github.com/urfave/cli/v2"
@@ -15,12 +18,18 @@ import (
 // RunServer - run http server for expose metrics
 func RunServer(ctx *cli.Context) error {
 	metrics.InitMetrics()
+	if config.DataDir != "" {
+		go saveStateOnShutdown()
+	}
 
 	r := router.New()
 	r.GET("/", func(ctx *fasthttp.RequestCtx) {
 		ctx.WriteString("/metrics")
 	})
 	r.GET("/metrics", prometheusHandler())
+	if config.Webhook.Secret != "" {
+		r.POST("/webhook", webhookHandler)
+	}
 
 	if config.Debug {
 		r.GET("/debug/pprof/", pprofHandlerIndex)
@@ -33,3 +42,14 @@ func RunServer(ctx *cli.Context) error {
 	log.Print("exporter listening on 0.0.0.0:" + strconv.Itoa(config.Port))
 	return fasthttp.ListenAndServe(":"+strconv.Itoa(config.Port), r.Handler)
 }
+
+// saveStateOnShutdown - save the state of the collectors before exiting, so that a restart doesn't lose any counter
+// increment which was already scraped
+func saveStateOnShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	log.Printf("Received %s, saving the state before exiting", sig)
+	metrics.SaveState()
+	os.Exit(0)
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/google/go-github/v45/github"
+	"github.com/valyala/fasthttp"
+
+	"github.com/faubion-hbo/github-actions-exporter/pkg/metrics"
+)
+
+// webhookHandler - fastHTTP handler for the Github webhook deliveries
+func webhookHandler(ctx *fasthttp.RequestCtx) {
+	event := string(ctx.Request.Header.Peek(github.EventTypeHeader))
+	signature := string(ctx.Request.Header.Peek(github.SHA256SignatureHeader))
+
+	err := metrics.HandleWebhook(event, signature, ctx.PostBody())
+	switch {
+	case errors.Is(err, metrics.ErrInvalidSignature):
+		ctx.Error(err.Error(), fasthttp.StatusUnauthorized)
+	case err != nil:
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+	default:
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+}